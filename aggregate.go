@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gaetanorusso/public_ledger_sensitive_data/miracl/go/core"
+	curve "github.com/gaetanorusso/public_ledger_sensitive_data/miracl/go/core/BN254"
+)
+
+//hashToSigPoint hash a message to the curve point signed by Sign
+//same construction used by the BLS functions of the curve package
+//message message to hash
+//return the point of G1
+func hashToSigPoint(message []byte) *curve.ECP {
+	q := curve.NewBIGints(curve.Modulus)
+	l := (q.Nbits() + curve.AESKEY*8 + 7) / 8
+	okm := core.XMD_Expand(core.MC_SHA2, curve.HASH_TYPE, 2*l, []byte(curve.BLS_DST), message)
+	p := curve.ECP_map2point(curve.NewFPbig(curve.DBIG_fromBytes(okm[:l]).Mod(q)))
+	p.Add(curve.ECP_map2point(curve.NewFPbig(curve.DBIG_fromBytes(okm[l:]).Mod(q))))
+	p.Cfp()
+	p.Affine()
+	return p
+}
+
+//AggregateSignatures combine BLS signatures into a single signature
+//sigs signatures to combine, possibly by different signers on different messages
+//return the aggregate signature, nil if there are no signatures
+//or a signature is not valid
+func AggregateSignatures(sigs [][]byte) []byte {
+	if len(sigs) == 0 {
+		fmt.Println("Error aggregating signatures: no signatures")
+		return nil
+	}
+	sum := curve.NewECP()
+	for i, sig := range sigs {
+		if len(sig) != SigLen {
+			fmt.Println("Error aggregating signatures: invalid signature", i)
+			return nil
+		}
+		point := curve.ECP_fromBytes(sig)
+		if point.Is_infinity() || !curve.G1member(point) {
+			fmt.Println("Error aggregating signatures: invalid signature", i)
+			return nil
+		}
+		sum.Add(point)
+	}
+	aggregate := make([]byte, SigLen)
+	sum.ToBytes(aggregate, true)
+	return aggregate
+}
+
+//BatchVerify verify an aggregate signature with a single multi-pairing
+//checks e(aggregate, G2) = prod e(H(messages[i]), publics[i]), the messages
+//signed by the same key are hashed and summed so that a single pairing
+//is computed for each distinct signer
+//publics public keys of the signers
+//messages signed messages, all distinct
+//aggregate aggregate of the signatures, see AggregateSignatures
+//return true if the aggregate signature is valid
+func BatchVerify(publics, messages [][]byte, aggregate []byte) bool {
+	if len(publics) != len(messages) || len(aggregate) != SigLen {
+		return false
+	}
+	blsInit()
+	//the aggregate signature is secure only on distinct messages
+	seen := make(map[string]bool)
+	for _, message := range messages {
+		if seen[string(message)] {
+			fmt.Println("Error verifying signatures: repeated message")
+			return false
+		}
+		seen[string(message)] = true
+	}
+	sig := curve.ECP_fromBytes(aggregate)
+	if !curve.G1member(sig) {
+		return false
+	}
+	//sum the hashed messages of each signer
+	var signers []string
+	hashes := make(map[string]*curve.ECP)
+	for i, public := range publics {
+		if len(public) != SigPubLen {
+			return false
+		}
+		signer := string(public)
+		if hashes[signer] == nil {
+			signers = append(signers, signer)
+			hashes[signer] = curve.NewECP()
+		}
+		hashes[signer].Add(hashToSigPoint(messages[i]))
+	}
+	sig.Neg()
+	r := curve.Initmp()
+	curve.Another_pc(r, curve.G2_TAB, sig)
+	for _, signer := range signers {
+		public := curve.ECP2_fromBytes([]byte(signer))
+		if !curve.G2member(public) {
+			return false
+		}
+		hashes[signer].Affine()
+		curve.Another(r, public, hashes[signer])
+	}
+	return curve.Fexp(curve.Miller(r)).Isunity()
+}
+
+//SignatureBatch struct that contains the signatures of a range of blocks
+//aggregated in a single signature
+type SignatureBatch struct {
+	Blocks    []int64
+	Publics   [][]byte
+	Messages  [][]byte
+	Signature []byte
+}
+
+//AggregateBlockSignatures aggregate the signatures of a range of blocks
+//unsigned blocks are skipped, the batch has no signature if no block is signed
+//from index of the first block
+//to index of the last block, included
+//return the aggregated signatures, nil on failure
+func (ledger Ledger) AggregateBlockSignatures(from, to int64) *SignatureBatch {
+	batch := &SignatureBatch{}
+	var sigs [][]byte
+	for i := from; i <= to; i++ {
+		block := ledger.GetBlock(i)
+		if block == nil {
+			return nil
+		}
+		sig, signed := block.Fields[FieldSignature]
+		if !signed {
+			if block.Fields[FieldSigner] != nil {
+				fmt.Println("Block", i, "has a signer but no signature")
+				return nil
+			}
+			continue
+		}
+		batch.Blocks = append(batch.Blocks, i)
+		batch.Publics = append(batch.Publics, block.Fields[FieldSigner])
+		batch.Messages = append(batch.Messages, block.SignedContent())
+		sigs = append(sigs, sig)
+	}
+	if len(sigs) > 0 {
+		if batch.Signature = AggregateSignatures(sigs); batch.Signature == nil {
+			return nil
+		}
+	}
+	return batch
+}
+
+//Verify verify the aggregate signature of a batch
+//return true if all the signatures of the batch are valid
+func (batch SignatureBatch) Verify() bool {
+	if len(batch.Blocks) == 0 {
+		return true
+	}
+	return BatchVerify(batch.Publics, batch.Messages, batch.Signature)
+}
+
+//AuditSignatures verify the signatures of a range of blocks at once
+//the signing keys must be the ones registered by the authors, if any
+//from index of the first block
+//to index of the last block, included
+//return the number of signed blocks, -1 if a signature is not valid
+func (ledger Ledger) AuditSignatures(from, to int64) int {
+	batch := ledger.AggregateBlockSignatures(from, to)
+	if batch == nil {
+		return -1
+	}
+	registry := ledger.ReadRegistry()
+	if registry == nil {
+		return -1
+	}
+	for _, i := range batch.Blocks {
+		if !ledger.GetBlock(i).checkSigner(registry) {
+			fmt.Println("Block", i, "signed by an unregistered key")
+			return -1
+		}
+	}
+	if !batch.Verify() {
+		fmt.Println("Aggregate signature of blocks", from, "to", to, "NOT valid")
+		return -1
+	}
+	return len(batch.Blocks)
+}
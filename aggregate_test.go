@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+)
+
+//newSignedLedger create a ledger with signed and unsigned blocks
+//blocks 0, 1 and 3 are signed, by alice with her registered identity and by
+//an anonymous writer, block 2 is not signed
+//return the ledger
+func newSignedLedger(t *testing.T) Ledger {
+	ledger, fk := newTestLedger(t, 16)
+	alice, anon := GenUser(), GenUser()
+	if !ledger.Register("alice", *alice) {
+		t.Fatal("registration failed")
+	}
+	aliceToken, anonToken := fk.TokenGen(alice.PublicKey), fk.TokenGen(anon.PublicKey)
+	signed := BlockOptions{Author: IdentityAuthor("alice"), Sign: true}
+	indices := []int64{
+		alice.AddBlockWith(ledger, aliceToken, newTestFile(t, 100), signed),
+		anon.AddBlockWith(ledger, anonToken, newTestFile(t, 200), BlockOptions{Sign: true}),
+		anon.AddBlock(ledger, anonToken, newTestFile(t, 300)),
+		alice.AddBlockWith(ledger, aliceToken, newTestFile(t, 400), signed),
+	}
+	for i, index := range indices {
+		if index != int64(i) {
+			t.Fatal("block not added")
+		}
+	}
+	return ledger
+}
+
+func TestAuditSignatures(t *testing.T) {
+	ledger := newSignedLedger(t)
+	//unsigned blocks are skipped
+	batch := ledger.AggregateBlockSignatures(0, 3)
+	if batch == nil || len(batch.Blocks) != 3 || batch.Blocks[2] != 3 || !batch.Verify() {
+		t.Fatal("aggregate signature not valid")
+	}
+	if ledger.AuditSignatures(0, 3) != 3 || ledger.AuditSignatures(2, 2) != 0 || ledger.AuditSignatures(1, 2) != 1 {
+		t.Fatal("unexpected number of signed blocks")
+	}
+	//empty range
+	if empty := ledger.AggregateBlockSignatures(3, 2); empty == nil || len(empty.Blocks) != 0 || !empty.Verify() {
+		t.Fatal("empty range not verified")
+	}
+	if ledger.AuditSignatures(3, 2) != 0 || AggregateSignatures(nil) != nil {
+		t.Fatal("empty range not verified")
+	}
+}
+
+func TestAuditSignaturesTampered(t *testing.T) {
+	ledger := newSignedLedger(t)
+	//the signature of block 1 is replaced by a valid signature on another
+	//message
+	block := ledger.GetBlock(1)
+	key := GenSigningKey()
+	block.Fields[FieldSigner] = key.Public
+	block.Fields[FieldSignature] = key.Sign([]byte("another message"))
+	if !ledger.WriteBlock(1, *block) {
+		t.Fatal("block not written")
+	}
+	batch := ledger.AggregateBlockSignatures(0, 3)
+	if batch == nil || batch.Verify() {
+		t.Fatal("aggregate with a tampered signature verified")
+	}
+	if ledger.AuditSignatures(0, 3) >= 0 || ledger.AuditSignatures(1, 1) >= 0 {
+		t.Fatal("tampered signature not reported")
+	}
+	if ledger.AuditSignatures(2, 3) != 1 {
+		t.Fatal("range without the tampered block not verified")
+	}
+}
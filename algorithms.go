@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha512"
+	"fmt"
+
+	"github.com/gaetanorusso/public_ledger_sensitive_data/miracl/go/core"
+	"golang.org/x/crypto/sha3"
+)
+
+//names of the ledger parameters with the algorithms of the ledger
+const (
+	//ParamHash name of the hash function, see HashAlgorithms
+	ParamHash = "hash"
+	//ParamXOF name of the XOF deriving the pads, see XOFAlgorithms
+	ParamXOF = "xof"
+)
+
+//HashAlgorithm struct that describes a hash function with HashLen bytes digests
+//the digest size is fixed by the file formats, see HashLen
+type HashAlgorithm struct {
+	ID   byte
+	Name string
+	Sum  func([]byte) [HashLen]byte
+}
+
+//XOFAlgorithm struct that describes an extendable output function
+//MaxOutput is the maximum output length in bytes, 0 if unlimited
+type XOFAlgorithm struct {
+	ID        byte
+	Name      string
+	Expand    func([]byte, []byte)
+	MaxOutput int
+}
+
+//padDST domain separation tag of the pads derived with HKDF and XMD
+var padDST = []byte("PLSD-PAD-V01")
+
+//HashAlgorithms hash functions that can be used by a ledger
+var HashAlgorithms = []HashAlgorithm{
+	{0, "sha3-512", sha3.Sum512},
+	{1, "sha-512", sha512.Sum512},
+	{2, "shake256", func(data []byte) [HashLen]byte {
+		var digest [HashLen]byte
+		sha3.ShakeSum256(digest[:], data)
+		return digest
+	}},
+}
+
+//XOFAlgorithms extendable output functions that can derive the pads of a ledger
+var XOFAlgorithms = []XOFAlgorithm{
+	{0, "shake256", sha3.ShakeSum256, 0},
+	{1, "shake128", sha3.ShakeSum128, 0},
+	{2, "hkdf-sha512", func(out, in []byte) {
+		prk := core.HKDF_Extract(core.MC_SHA2, core.SHA512, padDST, in)
+		copy(out, core.HKDF_Expand(core.MC_SHA2, core.SHA512, len(out), prk, nil))
+	}, 255 * core.SHA512},
+	{3, "xmd-sha512", func(out, in []byte) {
+		copy(out, core.XMD_Expand(core.MC_SHA2, core.SHA512, len(out), padDST, in))
+	}, 255 * core.SHA512},
+}
+
+//HashName name of the hash function in use, see Hash
+var HashName = "sha3-512"
+
+//XOFName name of the XOF in use, see MapHash
+var XOFName = "shake256"
+
+//SetAlgorithms choose the hash function and the XOF in use
+//modifies global variables Hash, MapHash, HashName and XOFName
+//hashName name of the hash function
+//xofName name of the XOF
+//return true if both algorithms are known and the XOF can derive pads of PadSize bytes
+func SetAlgorithms(hashName, xofName string) bool {
+	hash := lookupHash(hashName)
+	xof := lookupXOF(xofName)
+	if hash == nil || xof == nil {
+		fmt.Println("Unknown algorithms:", hashName, xofName)
+		return false
+	}
+	if xof.MaxOutput > 0 && PadSize > xof.MaxOutput {
+		fmt.Println("Pad size too big for", xofName)
+		return false
+	}
+	Hash, HashName = hash.Sum, hash.Name
+	MapHash, XOFName = xof.Expand, xof.Name
+	return true
+}
+
+//lookupHash find a hash function by name
+//return the hash function, nil if unknown
+func lookupHash(name string) *HashAlgorithm {
+	for i := range HashAlgorithms {
+		if HashAlgorithms[i].Name == name {
+			return &HashAlgorithms[i]
+		}
+	}
+	return nil
+}
+
+//lookupXOF find an XOF by name
+//return the XOF, nil if unknown
+func lookupXOF(name string) *XOFAlgorithm {
+	for i := range XOFAlgorithms {
+		if XOFAlgorithms[i].Name == name {
+			return &XOFAlgorithms[i]
+		}
+	}
+	return nil
+}
+
+//algorithmsField encode the algorithms in use for the block header
+//return the identifiers of hash function and XOF
+func algorithmsField() []byte {
+	return []byte{lookupHash(HashName).ID, lookupXOF(XOFName).ID}
+}
+
+//LoadAlgorithms choose the algorithms recorded in the ledger parameters
+//ledgers without the parameters use SHA3-512 and SHAKE256
+//the parameters file path is taken from Ledger struct
+//return true if the recorded algorithms are known
+func (ledger Ledger) LoadAlgorithms() bool {
+	params := ledger.ReadParams()
+	if params == nil {
+		return false
+	}
+	hashName, xofName := params[ParamHash], params[ParamXOF]
+	if hashName == "" {
+		hashName = "sha3-512"
+	}
+	if xofName == "" {
+		xofName = "shake256"
+	}
+	return SetAlgorithms(hashName, xofName)
+}
+
+//checkAlgorithms check that a block uses the algorithms of the ledger
+//block block to check
+//return true if the block records the algorithms in use, or none
+func checkAlgorithms(block *Block) bool {
+	encoded, ok := block.Fields[FieldAlgorithms]
+	if !ok {
+		return true
+	}
+	current := algorithmsField()
+	return len(encoded) == 2 && encoded[0] == current[0] && encoded[1] == current[1]
+}
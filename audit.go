@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+//types of the audit log entries
+const (
+	//AuditToken token issued: key fingerprint, epoch
+	AuditToken byte = 0
+	//AuditUpdate time-key update: old epoch, new epoch,
+	//number of shards, number of keys, duration in nanoseconds
+	AuditUpdate byte = 1
+	//AuditRevoke public key revoked: key fingerprint, epoch
+	AuditRevoke byte = 2
+	//AuditShred block shredded: block index, epoch
+	AuditShred byte = 3
+	//AuditCheckpoint state of the ledger: epoch, number of keys,
+	//digest of the head block, of the shards file and of the keys file
+	AuditCheckpoint byte = 4
+	//AuditExtend masking shards added: old and new number of shards,
+	//index of the first block using the new shards
+	AuditExtend byte = 5
+)
+
+//ParamFileKeeperKey name of the parameter with the filekeeper public key
+const ParamFileKeeperKey = "filekeeper-key"
+
+//AuditEntry struct that contains an entry of the audit log
+//each entry contains the digest of the previous one and is signed
+//by the filekeeper, the signature covers all the other fields
+type AuditEntry struct {
+	Prev      []byte
+	Type      byte
+	Time      int64
+	Payload   []byte
+	Signature []byte
+}
+
+//auditHeaderLen byte size of the fields preceding the payload
+const auditHeaderLen = HashLen + 1 + 8
+
+//signedPart encode the fields of the entry covered by the signature
+func (entry AuditEntry) signedPart() []byte {
+	encoded := make([]byte, auditHeaderLen, auditHeaderLen+len(entry.Payload)+SigLen)
+	copy(encoded, entry.Prev)
+	encoded[HashLen] = entry.Type
+	binary.BigEndian.PutUint64(encoded[HashLen+1:], uint64(entry.Time))
+	return append(encoded, entry.Payload...)
+}
+
+//ToBytes encode an audit entry
+//return the encoded entry
+func (entry AuditEntry) ToBytes() []byte {
+	return append(entry.signedPart(), entry.Signature...)
+}
+
+//AuditEntryFromBytes decode an audit entry
+//encoded encoded entry
+//return the entry, nil if malformed
+func AuditEntryFromBytes(encoded []byte) *AuditEntry {
+	if len(encoded) < auditHeaderLen+SigLen {
+		fmt.Println("Error decoding audit entry: incomplete entry!")
+		return nil
+	}
+	return &AuditEntry{
+		Prev:      encoded[:HashLen],
+		Type:      encoded[HashLen],
+		Time:      int64(binary.BigEndian.Uint64(encoded[HashLen+1:])),
+		Payload:   encoded[auditHeaderLen : len(encoded)-SigLen],
+		Signature: encoded[len(encoded)-SigLen:],
+	}
+}
+
+//String describe an audit entry
+func (entry AuditEntry) String() string {
+	when := time.Unix(0, entry.Time).UTC().Format(time.RFC3339Nano)
+	p := entry.Payload
+	field := func(i int) int64 {
+		return int64(binary.BigEndian.Uint64(p[8*i:]))
+	}
+	switch {
+	case entry.Type == AuditToken && len(p) == 24:
+		return fmt.Sprintf("%s token %x epoch %d", when, p[:16], field(2))
+	case entry.Type == AuditRevoke && len(p) == 24:
+		return fmt.Sprintf("%s revoke %x epoch %d", when, p[:16], field(2))
+	case entry.Type == AuditUpdate && len(p) == 40:
+		return fmt.Sprintf("%s update epoch %d -> %d shards %d keys %d duration %s",
+			when, field(0), field(1), field(2), field(3), time.Duration(field(4)))
+	case entry.Type == AuditShred && len(p) == 16:
+		return fmt.Sprintf("%s shred block %d epoch %d", when, field(0), field(1))
+	case entry.Type == AuditExtend && len(p) == 24:
+		return fmt.Sprintf("%s extend shards %d -> %d from block %d", when, field(0), field(1), field(2))
+	case entry.Type == AuditCheckpoint && len(p) == 16+3*HashLen:
+		return fmt.Sprintf("%s checkpoint epoch %d keys %d head %x shards %x keys %x", when, field(0), field(1),
+			p[16:16+HashLen], p[16+HashLen:16+2*HashLen], p[16+2*HashLen:])
+	}
+	return when + " unknown entry " + hex.EncodeToString(p)
+}
+
+//SetSigner set the BLS key used by the filekeeper to sign the audit log
+//and the revocations
+//the public key is recorded in the ledger parameters, the audit log is
+//resumed from its last entry and the revocation list is loaded from
+//the revocations signed with the key
+//key signing key of the filekeeper
+//return true if the audit log can be written,
+//false if it has been signed with another key or the ledger pins another key
+func (fk *FileKeeper) SetSigner(key *SigningKey) bool {
+	fk.stateMu.Lock()
+	defer fk.stateMu.Unlock()
+	fk.auditMu.Lock()
+	defer fk.auditMu.Unlock()
+	records := ReadRecords(fk.Ledger.AuditFile)
+	params := fk.Ledger.ReadParams()
+	revocations := fk.Ledger.Revocations(key.Public)
+	if records == nil || params == nil || revocations == nil {
+		return false
+	}
+	if ledger := fk.Ledger; ledger.FileKeeperKey != nil && !bytes.Equal(ledger.FileKeeperKey, key.Public) {
+		fmt.Println("Error setting signing key: not the pinned filekeeper key")
+		return false
+	}
+	public := hex.EncodeToString(key.Public)
+	if len(records) > 0 && params[ParamFileKeeperKey] != public {
+		fmt.Println("Error resuming audit log: signed with another key")
+		return false
+	}
+	head := make([]byte, HashLen)
+	if len(records) > 0 {
+		h := Hash(records[len(records)-1])
+		head = h[:]
+	}
+	if !fk.Ledger.SetParam(ParamFileKeeperKey, public) {
+		return false
+	}
+	fk.signer = key
+	fk.auditHead = head
+	for _, rev := range revocations {
+		fk.revoked[keyID(rev.PublicKey)] = true
+	}
+	return true
+}
+
+//audit append a signed entry to the audit log
+//nothing is written if the filekeeper has no signing key
+//entryType type of the entry
+//fields payload of the entry
+//return true if the entry was written or no signing key is set
+func (fk *FileKeeper) audit(entryType byte, fields ...[]byte) bool {
+	fk.auditMu.Lock()
+	defer fk.auditMu.Unlock()
+	if fk.signer == nil {
+		return true
+	}
+	entry := AuditEntry{
+		Prev:    fk.auditHead,
+		Type:    entryType,
+		Time:    time.Now().UnixNano(),
+		Payload: bytes.Join(fields, nil),
+	}
+	entry.Signature = fk.signer.Sign(entry.signedPart())
+	encoded := entry.ToBytes()
+	if !AppendRecord(fk.Ledger.AuditFile, encoded) {
+		return false
+	}
+	h := Hash(encoded)
+	fk.auditHead = h[:]
+	return true
+}
+
+//RecordedFileKeeperKey read the public key of the filekeeper recorded in the
+//ledger parameters
+//the parameters file is not authenticated, use it only to display or
+//when no key is pinned
+//the parameters file path is taken from Ledger struct
+//return the public key, nil if not recorded or malformed
+func (ledger Ledger) RecordedFileKeeperKey() []byte {
+	params := ledger.ReadParams()
+	if params == nil {
+		return nil
+	}
+	return decodeSigPub(params[ParamFileKeeperKey])
+}
+
+//keyFingerprint compute the fingerprint of a user public key
+//pubKey public key of the user
+//return the fingerprint of the compressed key
+func keyFingerprint(pubKey G1) []byte {
+	return Fingerprint(pubKey.Bytes())
+}
+
+//AuditEntries read the audit log
+//the audit log file path is taken from Ledger struct
+//return the entries in order, nil if the log cannot be read
+func (ledger Ledger) AuditEntries() []AuditEntry {
+	records := ReadRecords(ledger.AuditFile)
+	if records == nil {
+		return nil
+	}
+	entries := make([]AuditEntry, len(records))
+	for i, record := range records {
+		entry := AuditEntryFromBytes(record)
+		if entry == nil {
+			return nil
+		}
+		entries[i] = *entry
+	}
+	return entries
+}
+
+//VerifyAudit verify the audit log
+//checks the hash chain and the signature of every entry
+//public public key of the filekeeper, nil to use the pinned key of the
+//Ledger struct or, if not pinned, the key recorded in the ledger parameters
+//return the number of verified entries, -1 if the log is not valid
+func (ledger Ledger) VerifyAudit(public []byte) int {
+	if public == nil {
+		public = ledger.FileKeeperKey
+	}
+	if public == nil {
+		if public = ledger.RecordedFileKeeperKey(); public == nil {
+			return -1
+		}
+	}
+	records := ReadRecords(ledger.AuditFile)
+	if records == nil {
+		return -1
+	}
+	prev := make([]byte, HashLen)
+	for i, record := range records {
+		entry := AuditEntryFromBytes(record)
+		if entry == nil {
+			return -1
+		}
+		if !bytes.Equal(prev, entry.Prev) {
+			fmt.Println("Audit entry", i, "not linked to the previous one")
+			return -1
+		}
+		if !VerifySignature(public, entry.signedPart(), entry.Signature) {
+			fmt.Println("Audit entry", i, "has an invalid signature")
+			return -1
+		}
+		h := Hash(record)
+		prev = h[:]
+	}
+	return len(records)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+)
+
+//batchEntry struct that contains a file of a batch being encrypted
+type batchEntry struct {
+	fileName   string
+	plainName  string
+	ctName     string
+	chunksName string
+	metaName   string
+	metaNonce  []byte
+	keyEnc     G1
+	ptDigest   []byte
+	ctDigest   []byte
+	chunksRoot []byte
+	metaDigest []byte
+}
+
+//AddBlocks encrypt many files and add them to the ledger in one transaction
+//the files are encrypted concurrently with the masking shards read once;
+//then, holding the writer lock of the ledger, ciphertexts and chained blocks
+//are written and finally all the encapsulated keys are appended with a single
+//write, which commits the batch; on any failure the written files are removed
+//and no block is added
+//ledger struct with file paths of the ledger
+//token encryption token given by filekeeper
+//fileNames paths to the files to encrypt
+//opts optional settings of the blocks
+//the indices are also recorded in the list of blocks owned by the user
+//return the indices of the added blocks in the order of fileNames, nil on failure
+func (u *User) AddBlocks(ledger Ledger, token G1, fileNames []string, opts BlockOptions) []int64 {
+	if len(fileNames) == 0 {
+		return []int64{}
+	}
+	epoch := ledger.Epoch()
+	if opts.Expiry > 0 && opts.Expiry <= epoch {
+		fmt.Println("Block expired: expiry", opts.Expiry, "not after current epoch")
+		return nil
+	}
+	entries := make([]batchEntry, len(fileNames))
+	//compressed plaintexts are removed once encrypted
+	defer func() {
+		for _, entry := range entries {
+			if entry.plainName != entry.fileName {
+				os.Remove(entry.plainName)
+			}
+		}
+	}()
+	//the shards of the ledger bound the size of the files
+	numShards, maxShards := 0, ledger.NumShards()
+	if maxShards < 0 {
+		return nil
+	}
+	for j, fileName := range fileNames {
+		entries[j].fileName = fileName
+		entries[j].plainName = fileName
+		if opts.Compress {
+			if entries[j].plainName = compressFile(fileName); entries[j].plainName == "" {
+				return nil
+			}
+		}
+		fi, err := os.Stat(entries[j].plainName)
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		if fi.Size() > int64(PadSize)*int64(maxShards) {
+			fmt.Println("File too big!", fileName)
+			return nil
+		}
+		if n := CountShards(entries[j].plainName); n > numShards {
+			numShards = n
+		}
+	}
+	//read once the shards needed by the largest file
+	eps := ledger.ShardRange(numShards)
+	if eps == nil {
+		return nil
+	}
+	//generate encryption keys and encapsulated keys
+	//randomness is read in order, so that runs with the same source are reproducible
+	keys := make([]G1, len(fileNames))
+	for j := range entries {
+		r := GenExpFrom(u.Rand)
+		keys[j] = token.Mul(r)
+		r.Wipe()
+		if entries[j].metaNonce = readRandom(u.Rand, MetadataNonceLen); entries[j].metaNonce == nil {
+			return nil
+		}
+		entries[j].ctName = ledger.tempCiphertextName()
+		entries[j].chunksName = entries[j].ctName + ChunksExt
+		entries[j].metaName = entries[j].ctName + MetadataExt
+		if entries[j].keyEnc = u.EncapsulateKey(keys[j]); entries[j].keyEnc == nil {
+			return nil
+		}
+	}
+	//encrypt concurrently, the indices are not known yet
+	var wg sync.WaitGroup
+	for j := range entries {
+		wg.Add(1)
+		go func(entry *batchEntry, key G1) {
+			defer wg.Done()
+			EncryptFile(entry.plainName, entry.ctName, eps, key)
+			entry.ctDigest = FileDigest(entry.ctName)
+			//the plaintext commitment is over the original content
+			entry.ptDigest = PlaintextCommitment(entry.fileName, eps[0], key)
+			//keyed digests of the encrypted chunks, compressed if so
+			chunksKey := chunkKey(eps[0], key)
+			leaves := chunkLeaves(entry.plainName, chunksKey)
+			Wipe(chunksKey)
+			if leaves != nil && writeLeaves(entry.chunksName, leaves) {
+				entry.chunksRoot = merkleRoot(leaves)
+			}
+			//metadata of the original file
+			if meta := FileMetadata(entry.fileName); meta != nil {
+				sealed := sealMetadata(*meta, eps[0], key, entry.metaNonce)
+				if sealed != nil && ioutil.WriteFile(entry.metaName, sealed, 0644) == nil {
+					h := Hash(sealed)
+					entry.metaDigest = h[:]
+				}
+			}
+			//only the encapsulated key is kept
+			key.Wipe()
+		}(&entries[j], keys[j])
+	}
+	wg.Wait()
+	//remove everything written by the batch
+	first := int64(-1)
+	written := 0
+	rollback := func() []int64 {
+		for j := range entries {
+			os.Remove(entries[j].ctName)
+			os.Remove(entries[j].chunksName)
+			os.Remove(entries[j].metaName)
+			if j < written {
+				os.Remove(ledger.BlockName(first + int64(j)))
+			}
+		}
+		fmt.Println("Batch of", len(fileNames), "files rolled back")
+		return nil
+	}
+	for _, entry := range entries {
+		if entry.ctDigest == nil || entry.ptDigest == nil || entry.chunksRoot == nil || entry.metaDigest == nil {
+			return rollback()
+		}
+	}
+	var signer *SigningKey
+	if opts.Sign {
+		signer = u.SigningKey()
+	}
+	//assign indices and write holding the writer lock
+	unlock := ledger.Lock()
+	if unlock == nil {
+		return rollback()
+	}
+	defer unlock()
+	//the token and the shards are valid only in the epoch they were read
+	if ledger.Epoch() != epoch {
+		fmt.Println("Error adding blocks: the ledger was updated, request a new token")
+		return rollback()
+	}
+	segments := ledger.ShardSegments()
+	if first = ledger.NumKeys(); first < 0 || segments == nil {
+		return rollback()
+	}
+	//write ciphertexts and chained blocks
+	prev := FileDigest(ledger.BlockName(first - 1))
+	keyEncs := make([]G1, len(entries))
+	for j := range entries {
+		entry := &entries[j]
+		keyIndex := first + int64(j)
+		ctName := ledger.EncryptPath + strconv.FormatInt(keyIndex, 16) + ".enc"
+		if err := os.Rename(entry.ctName, ctName); err != nil {
+			fmt.Println(err)
+			return rollback()
+		}
+		entry.ctName = ctName
+		if err := os.Rename(entry.chunksName, ledger.ChunksName(keyIndex)); err != nil {
+			fmt.Println(err)
+			return rollback()
+		}
+		entry.chunksName = ledger.ChunksName(keyIndex)
+		if err := os.Rename(entry.metaName, ledger.MetadataName(keyIndex)); err != nil {
+			fmt.Println(err)
+			return rollback()
+		}
+		entry.metaName = ledger.MetadataName(keyIndex)
+		block := Block{Fields: make(map[byte][]byte)}
+		block.Prev = prev
+		block.CtDigest = entry.ctDigest
+		block.PtDigest = entry.ptDigest
+		block.Fields[FieldChunks] = entry.chunksRoot
+		block.Fields[FieldMetadata] = entry.metaDigest
+		block.Fields[FieldCommitment] = []byte{CommitKeyed}
+		block.Fields[FieldAlgorithms] = algorithmsField()
+		if opts.Compress {
+			block.Fields[FieldCompression] = []byte{CompressFlate}
+		}
+		control := ledger.controlShard(segments, keyIndex)
+		if control == nil {
+			return rollback()
+		}
+		block.Control = HashAte(control, entry.keyEnc)
+		u.setFields(&block, keyIndex, opts, signer)
+		if !ledger.WriteBlock(keyIndex, block) {
+			return rollback()
+		}
+		written++
+		h := Hash(block.ToBytes())
+		prev = h[:]
+		keyEncs[j] = entry.keyEnc
+	}
+	//commit appending the encapsulated keys
+	if ledger.AppendEncapsulatedKeys(keyEncs) != first {
+		fmt.Println("Error adding blocks: encapsulated keys not appended")
+		//keys partially appended would refer to removed blocks
+		if !ledger.truncateKeys(first) {
+			panic("Error rolling back encapsulated keys!")
+		}
+		return rollback()
+	}
+	indices := make([]int64, len(entries))
+	for j := range indices {
+		indices[j] = first + int64(j)
+	}
+	u.Blocks = append(u.Blocks, indices...)
+	return indices
+}
+
+//truncateKeys remove the last encapsulated keys from the key-file
+//path to the file containing the encapsulated keys taken from Ledger struct
+//numKeys number of keys to keep
+//return true if the key-file was truncated
+func (ledger Ledger) truncateKeys(numKeys int64) bool {
+	if err := os.Truncate(ledger.KeysFile, numKeys*int64(Group.G1Len())); err != nil && !os.IsNotExist(err) {
+		fmt.Println(err)
+		return false
+	}
+	return true
+}
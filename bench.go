@@ -0,0 +1,425 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+//BenchConfig parameters of a benchmark run
+//every combination of shard count and worker count is measured on a new
+//ledger, and on each ledger every pad size and file size that fit the shards
+type BenchConfig struct {
+	PadSizes    []int
+	ShardCounts []int
+	FileSizes   []int
+	//Workers values of GOMAXPROCS, the goroutines of Init, encryption,
+	//decryption and Update run on at most this many threads
+	Workers []int
+	//Rounds number of times each operation is repeated
+	Rounds int
+}
+
+//DefaultBench default parameters of the bench command
+var DefaultBench = BenchConfig{
+	PadSizes:    []int{96, 1024, 8192},
+	ShardCounts: []int{1000, 10000},
+	FileSizes:   []int{1 << 10, 1 << 16, 1 << 20},
+	Workers:     benchWorkers(),
+	Rounds:      3,
+}
+
+//benchWorkers worker counts measured by default: one and all the CPUs
+func benchWorkers() []int {
+	if runtime.NumCPU() == 1 {
+		return []int{1}
+	}
+	return []int{1, runtime.NumCPU()}
+}
+
+//BenchResult average time of an operation in a benchmark run
+//the parameters that do not affect the operation are zero
+type BenchResult struct {
+	Operation string `json:"operation"`
+	Shards    int    `json:"shards"`
+	Workers   int    `json:"workers"`
+	PadSize   int    `json:"pad_size,omitempty"`
+	FileSize  int    `json:"file_size,omitempty"`
+	//Blocks number of blocks of the ledger
+	Blocks  int64 `json:"blocks,omitempty"`
+	Rounds  int   `json:"rounds"`
+	NsPerOp int64 `json:"ns_per_op"`
+	//MBPerSec throughput of the operations on files
+	MBPerSec float64 `json:"mb_per_sec,omitempty"`
+}
+
+//Params parameters of the measurement, in the format of the names of
+//the Go benchmarks
+func (result BenchResult) Params() string {
+	params := "shards=" + strconv.Itoa(result.Shards) + "/workers=" + strconv.Itoa(result.Workers)
+	if result.PadSize > 0 {
+		params += "/pad=" + strconv.Itoa(result.PadSize)
+	}
+	if result.FileSize > 0 {
+		params += "/size=" + strconv.Itoa(result.FileSize)
+	}
+	if result.Blocks > 0 {
+		params += "/blocks=" + strconv.FormatInt(result.Blocks, 10)
+	}
+	return params
+}
+
+//Name name identifying the measurement across reports
+func (result BenchResult) Name() string {
+	return result.Operation + "/" + result.Params()
+}
+
+//String describe a measurement, in the format of the Go benchmarks
+func (result BenchResult) String() string {
+	s := fmt.Sprintf("%s %d ns/op", result.Name(), result.NsPerOp)
+	if result.MBPerSec > 0 {
+		s += fmt.Sprintf(" %.2f MB/s", result.MBPerSec)
+	}
+	return s
+}
+
+//BenchReport machine-readable report of a benchmark run
+//the environment is recorded so that reports of different releases
+//are compared on the same machine and settings
+type BenchReport struct {
+	Date      time.Time     `json:"date"`
+	GoVersion string        `json:"go_version"`
+	OS        string        `json:"os"`
+	Arch      string        `json:"arch"`
+	CPUs      int           `json:"cpus"`
+	Group     string        `json:"group"`
+	Hash      string        `json:"hash"`
+	XOF       string        `json:"xof"`
+	Results   []BenchResult `json:"results"`
+}
+
+//benchTime measure the average time of an operation
+//rounds number of repetitions
+//setup function run before each repetition and not measured, nil if none
+//op operation to measure
+//return the average time in nanoseconds, -1 if setup or operation fail
+func benchTime(rounds int, setup func(round int) bool, op func() bool) int64 {
+	var total time.Duration
+	for i := 0; i < rounds; i++ {
+		if setup != nil && !setup(i) {
+			return -1
+		}
+		startTime := time.Now()
+		ok := op()
+		total += time.Now().Sub(startTime)
+		if !ok {
+			return -1
+		}
+	}
+	return int64(total) / int64(rounds)
+}
+
+//benchLedger ledger with all its files in a folder
+//dir folder of the ledger, created if missing
+//return the ledger, its files are not initialised
+func benchLedger(dir string) Ledger {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Println(err)
+	}
+	return Ledger{
+		ShardsFile:   filepath.Join(dir, "shards.enc"),
+		KeysFile:     filepath.Join(dir, "keys.enc"),
+		RootPath:     filepath.Join(dir, "block"),
+		EncryptPath:  filepath.Join(dir, "ct"),
+		RegistryFile: filepath.Join(dir, "registry.enc"),
+		ParamsFile:   filepath.Join(dir, "params.txt"),
+		AuditFile:    filepath.Join(dir, "audit.log"),
+	}
+}
+
+//benchFile write a file of random bytes
+//dir folder of the file
+//size size of the file
+//return the path of the file, empty on failure
+func benchFile(dir string, size int) string {
+	content := make([]byte, size)
+	if _, err := rand.Read(content); err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	fileName := filepath.Join(dir, "plain"+strconv.Itoa(size))
+	if err := ioutil.WriteFile(fileName, content, 0644); err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return fileName
+}
+
+//RunBench measure Init, TokenGen, AddBlock, DecryptBlock, CheckConsistency
+//and Update for every combination of the parameters
+//the ledgers are created in a temporary folder, removed once done;
+//PadSize, MaxShards and GOMAXPROCS are restored once done
+//config parameters of the run
+//dir folder of the temporary files, empty for the default temporary folder
+//return the report, nil on failure
+func RunBench(config BenchConfig, dir string) *BenchReport {
+	if config.Rounds < 1 {
+		fmt.Println("Invalid benchmark: non-positive number of rounds")
+		return nil
+	}
+	padSize, maxShards, procs := PadSize, MaxShards, runtime.GOMAXPROCS(0)
+	defer func() {
+		PadSize, MaxShards = padSize, maxShards
+		runtime.GOMAXPROCS(procs)
+	}()
+	report := &BenchReport{
+		Date:      time.Now().UTC(),
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		Group:     Group.Name(),
+		Hash:      HashName,
+		XOF:       XOFName,
+		Results:   []BenchResult{},
+	}
+	for _, shards := range config.ShardCounts {
+		for _, workers := range config.Workers {
+			if shards < 1 || workers < 1 {
+				fmt.Println("Invalid benchmark: non-positive number of shards or workers")
+				return nil
+			}
+			MaxShards = shards
+			runtime.GOMAXPROCS(workers)
+			runDir, err := ioutil.TempDir(dir, "bench")
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			results := benchLedgerRun(config, runDir)
+			os.RemoveAll(runDir)
+			if results == nil {
+				return nil
+			}
+			report.Results = append(report.Results, results...)
+		}
+	}
+	return report
+}
+
+//benchLedgerRun measure the operations on new ledgers
+//with MaxShards shards and the current GOMAXPROCS
+//Init and TokenGen do not depend on the pad size and are measured once;
+//the control shards of the blocks depend on it, so every pad size is
+//measured on its own ledger
+//config parameters of the run
+//dir empty folder of the ledgers
+//return the results, nil on failure
+func benchLedgerRun(config BenchConfig, dir string) []BenchResult {
+	base := BenchResult{Shards: MaxShards, Workers: runtime.GOMAXPROCS(0), Rounds: config.Rounds}
+	results := []BenchResult{}
+	record := func(operation string, ns int64, result BenchResult) bool {
+		if ns < 0 {
+			fmt.Println("Benchmark failed:", operation, result.Params())
+			return false
+		}
+		result.Operation, result.NsPerOp = operation, ns
+		if result.FileSize > 0 && ns > 0 {
+			result.MBPerSec = float64(result.FileSize) * 1e3 / float64(ns)
+		}
+		fmt.Println(result)
+		results = append(results, result)
+		return true
+	}
+	//every round of Init creates a new ledger, the last one is kept
+	var ledger Ledger
+	var s Scalar
+	ledgers := 0
+	newLedger := func(int) bool {
+		if s != nil {
+			s.Wipe()
+		}
+		ledger = benchLedger(filepath.Join(dir, "ledger"+strconv.Itoa(ledgers)))
+		ledgers++
+		return true
+	}
+	initLedger := func() bool {
+		s = ledger.Init()
+		return s != nil
+	}
+	if !record("Init", benchTime(config.Rounds, newLedger, initLedger), base) {
+		return nil
+	}
+	u := GenUser()
+	defer u.Destroy()
+	fk := NewFileKeeper(ledger, s)
+	if fk == nil {
+		return nil
+	}
+	defer func() { fk.Destroy() }()
+	ns := benchTime(config.Rounds, nil, func() bool {
+		return fk.TokenGen(u.PublicKey) != nil
+	})
+	if !record("TokenGen", ns, base) {
+		return nil
+	}
+	used := false
+	for _, pad := range config.PadSizes {
+		if pad < 2*Group.ScalarLen() {
+			fmt.Println("Skipping pad size", pad, "smaller than two scalars")
+			continue
+		}
+		PadSize = pad
+		//the ledger of Init is used for the first pad size
+		if used {
+			fk.Destroy()
+			if !newLedger(0) || !initLedger() {
+				return nil
+			}
+			next := NewFileKeeper(ledger, s)
+			if next == nil {
+				return nil
+			}
+			fk = next
+		}
+		used = true
+		result := base
+		result.PadSize = pad
+		if !benchBlocks(config, ledger, fk, u, result, record) {
+			return nil
+		}
+	}
+	return results
+}
+
+//benchBlocks measure the operations on the blocks of a ledger
+//AddBlock and DecryptBlock for every file size that fits the shards,
+//then CheckConsistency and Update of the ledger with the blocks added
+//config parameters of the run
+//fk filekeeper of the ledger
+//u user adding the blocks
+//base parameters of the measurements
+//record function recording a measurement, returns false on failure
+//return true if every operation succeeded
+func benchBlocks(config BenchConfig, ledger Ledger, fk *FileKeeper, u *User, base BenchResult,
+	record func(string, int64, BenchResult) bool) bool {
+	token := fk.TokenGen(u.PublicKey)
+	if token == nil {
+		return false
+	}
+	dir := filepath.Dir(ledger.KeysFile)
+	out := filepath.Join(dir, "decrypted")
+	for _, size := range config.FileSizes {
+		if size < 1 || size > PadSize*MaxShards {
+			fmt.Println("Skipping file size", size, "with pad size", PadSize, "and", MaxShards, "shards")
+			continue
+		}
+		fileName := benchFile(dir, size)
+		if fileName == "" {
+			return false
+		}
+		result := base
+		result.FileSize = size
+		index := int64(-1)
+		ns := benchTime(config.Rounds, nil, func() bool {
+			index = u.AddBlock(ledger, token, fileName)
+			return index >= 0
+		})
+		if !record("AddBlock", ns, result) {
+			return false
+		}
+		var unlocked G1
+		unlock := func(int) bool {
+			keyEnc := ledger.GetEncKey(index)
+			if keyEnc == nil {
+				return false
+			}
+			unlocked = u.UnlockKey(keyEnc)
+			return unlocked != nil
+		}
+		//every block added by the benchmark has metadata,
+		//a decryption without them failed
+		ns = benchTime(config.Rounds, unlock, func() bool {
+			meta := ledger.DecryptBlock(index, unlocked, out)
+			unlocked.Wipe()
+			return meta != nil
+		})
+		if !record("DecryptBlock", ns, result) {
+			return false
+		}
+	}
+	//the ledger now holds every block added
+	result := base
+	result.Blocks = ledger.NumKeys()
+	ns := benchTime(config.Rounds, nil, func() bool {
+		return ledger.CheckConsistency(-1, nil)
+	})
+	if !record("CheckConsistency", ns, result) {
+		return false
+	}
+	ns = benchTime(config.Rounds, nil, func() bool {
+		return fk.Update() != nil
+	})
+	return record("Update", ns, result)
+}
+
+//WriteBenchReport write a report as indented JSON
+//report report to write
+//fileName path of the report
+//return true if the report was written
+func WriteBenchReport(report BenchReport, fileName string) bool {
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	if err = ioutil.WriteFile(fileName, append(encoded, '\n'), 0644); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
+}
+
+//ReadBenchReport read a report written by WriteBenchReport
+//fileName path of the report
+//return the report, nil on failure
+func ReadBenchReport(fileName string) *BenchReport {
+	encoded, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		fmt.Println("File reading error", err)
+		return nil
+	}
+	var report BenchReport
+	if err = json.Unmarshal(encoded, &report); err != nil {
+		fmt.Println("Error decoding benchmark report:", err)
+		return nil
+	}
+	return &report
+}
+
+//CompareBench compare the measurements of two reports
+//old, new reports to compare
+//return one line for each measurement present in both reports,
+//with the times and the relative change from old to new
+func CompareBench(old, new BenchReport) []string {
+	before := make(map[string]int64)
+	for _, result := range old.Results {
+		before[result.Name()] = result.NsPerOp
+	}
+	lines := []string{}
+	for _, result := range new.Results {
+		ns, ok := before[result.Name()]
+		if !ok || ns <= 0 {
+			continue
+		}
+		change := 100 * (float64(result.NsPerOp) - float64(ns)) / float64(ns)
+		lines = append(lines, fmt.Sprintf("%s %d ns/op -> %d ns/op %+.1f%%", result.Name(), ns, result.NsPerOp, change))
+	}
+	return lines
+}
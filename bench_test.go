@@ -0,0 +1,186 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+//testBench parameters of the Go benchmarks, which run on BN254
+//the benchmarks are named like the measurements of the bench command
+var testBench = BenchConfig{
+	PadSizes:    []int{96, 1024},
+	ShardCounts: []int{256, 1024},
+	FileSizes:   []int{1 << 10, 1 << 16},
+	Workers:     benchWorkers(),
+}
+
+//benchmarkLedgers run a sub-benchmark on a new ledger for every
+//shard count and worker count of testBench
+//pads pad sizes of the ledgers, each on its own ledger; nil if the
+//operation does not depend on them
+//op benchmark of an operation on the ledger
+func benchmarkLedgers(b *testing.B, pads []int, op func(b *testing.B, ledger Ledger, fk *FileKeeper)) {
+	if pads == nil {
+		pads = []int{0}
+	}
+	for _, shards := range testBench.ShardCounts {
+		for _, workers := range testBench.Workers {
+			for _, pad := range pads {
+				b.Run(BenchResult{Shards: shards, Workers: workers, PadSize: pad}.Params(), func(b *testing.B) {
+					procs := runtime.GOMAXPROCS(workers)
+					defer runtime.GOMAXPROCS(procs)
+					ledger, fk := newTestLedgerFrom(b, BN254{}, shards, nil)
+					if pad > 0 {
+						PadSize = pad
+					}
+					op(b, ledger, fk)
+				})
+			}
+		}
+	}
+}
+
+//benchmarkFiles run a sub-benchmark for every file size of testBench
+//that fits the shards of the ledger
+//op benchmark of an operation on a file
+func benchmarkFiles(b *testing.B, op func(b *testing.B, fileName string)) {
+	for _, size := range testBench.FileSizes {
+		if size > PadSize*MaxShards {
+			continue
+		}
+		b.Run("size="+strconv.Itoa(size), func(b *testing.B) {
+			fileName := newTestFile(b, size)
+			b.SetBytes(int64(size))
+			op(b, fileName)
+		})
+	}
+}
+
+//benchmarkBlocks run a sub-benchmark on the ledger with blocks of 1 KiB
+//n number of blocks
+//op benchmark of an operation on the ledger
+func benchmarkBlocks(b *testing.B, ledger Ledger, fk *FileKeeper, n int, op func(b *testing.B)) {
+	u := GenUser()
+	token := fk.TokenGen(u.PublicKey)
+	for i := 0; i < n; i++ {
+		if u.AddBlock(ledger, token, newTestFile(b, 1<<10)) < 0 {
+			b.Fatal("block not added")
+		}
+	}
+	b.Run("blocks="+strconv.Itoa(n), op)
+}
+
+func BenchmarkInit(b *testing.B) {
+	benchmarkLedgers(b, nil, func(b *testing.B, ledger Ledger, fk *FileKeeper) {
+		dir := b.TempDir()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			ledger := benchLedger(filepath.Join(dir, strconv.Itoa(i)))
+			b.StartTimer()
+			ledger.Init()
+		}
+	})
+}
+
+func BenchmarkTokenGen(b *testing.B) {
+	benchmarkLedgers(b, nil, func(b *testing.B, ledger Ledger, fk *FileKeeper) {
+		u := GenUser()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			fk.TokenGen(u.PublicKey)
+		}
+	})
+}
+
+func BenchmarkAddBlock(b *testing.B) {
+	benchmarkLedgers(b, testBench.PadSizes, func(b *testing.B, ledger Ledger, fk *FileKeeper) {
+		u := GenUser()
+		token := fk.TokenGen(u.PublicKey)
+		benchmarkFiles(b, func(b *testing.B, fileName string) {
+			for i := 0; i < b.N; i++ {
+				u.AddBlock(ledger, token, fileName)
+			}
+		})
+	})
+}
+
+func BenchmarkDecryptBlock(b *testing.B) {
+	benchmarkLedgers(b, testBench.PadSizes, func(b *testing.B, ledger Ledger, fk *FileKeeper) {
+		u := GenUser()
+		token := fk.TokenGen(u.PublicKey)
+		out := filepath.Join(b.TempDir(), "decrypted")
+		benchmarkFiles(b, func(b *testing.B, fileName string) {
+			index := u.AddBlock(ledger, token, fileName)
+			if index < 0 {
+				b.Fatal("block not added")
+			}
+			unlocked := u.UnlockKey(ledger.GetEncKey(index))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if ledger.DecryptBlock(index, unlocked, out) == nil {
+					b.Fatal("block not decrypted")
+				}
+			}
+		})
+	})
+}
+
+func BenchmarkCheckConsistency(b *testing.B) {
+	benchmarkLedgers(b, testBench.PadSizes, func(b *testing.B, ledger Ledger, fk *FileKeeper) {
+		benchmarkBlocks(b, ledger, fk, 16, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ledger.CheckConsistency(-1, nil)
+			}
+		})
+	})
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	benchmarkLedgers(b, testBench.PadSizes, func(b *testing.B, ledger Ledger, fk *FileKeeper) {
+		benchmarkBlocks(b, ledger, fk, 16, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				fk.Update()
+			}
+		})
+	})
+}
+
+func TestRunBench(t *testing.T) {
+	Group, PadSize, MaxShards = testGroup{}, 96, 8
+	config := BenchConfig{PadSizes: []int{96, 200}, ShardCounts: []int{16}, FileSizes: []int{100, 5000}, Workers: []int{1, 2}, Rounds: 2}
+	report := RunBench(config, t.TempDir())
+	if report == nil {
+		t.Fatal("benchmark failed")
+	}
+	if PadSize != 96 || MaxShards != 8 {
+		t.Fatal("settings not restored")
+	}
+	//5000 bytes do not fit 16 shards, every pad size has its own ledger
+	var operations []string
+	for _, result := range report.Results[:len(report.Results)/2] {
+		operations = append(operations, result.Operation)
+	}
+	if !reflect.DeepEqual(operations, []string{"Init", "TokenGen",
+		"AddBlock", "DecryptBlock", "CheckConsistency", "Update", "AddBlock", "DecryptBlock", "CheckConsistency", "Update"}) {
+		t.Fatal("unexpected measurements", operations)
+	}
+	if last := report.Results[len(report.Results)-1]; last.Name() != "Update/shards=16/workers=2/pad=200/blocks=2" {
+		t.Fatal("unexpected measurement", last.Name())
+	}
+	//the report is read back and compared with itself
+	fileName := filepath.Join(t.TempDir(), "bench.json")
+	if !WriteBenchReport(*report, fileName) {
+		t.Fatal("report not written")
+	}
+	read := ReadBenchReport(fileName)
+	if read == nil || !reflect.DeepEqual(read.Results, report.Results) || read.Group != (testGroup{}).Name() {
+		t.Fatal("report not read back")
+	}
+	if lines := CompareBench(*report, *read); len(lines) != len(report.Results) {
+		t.Fatal("measurements not compared", lines)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+)
+
+//tags of the optional block fields
+const (
+	//FieldAuthor reference to the author of the block
+	FieldAuthor byte = 1
+	//FieldShare index of the shared block and part of the shared key
+	FieldShare byte = 2
+	//FieldShred digest of the secret that allows the owner to shred the block
+	FieldShred byte = 3
+	//FieldExpiry epoch from which the block cannot be decrypted anymore
+	FieldExpiry byte = 4
+	//FieldSigner BLS public key of the author signing the block
+	FieldSigner byte = 5
+	//FieldSignature BLS signature of the author on the rest of the block
+	FieldSignature byte = 6
+	//FieldChunks Merkle root of the keyed digests of the plaintext chunks
+	FieldChunks byte = 7
+	//FieldCompression algorithm that compressed the plaintext before encryption
+	FieldCompression byte = 8
+	//FieldMetadata digest of the encrypted metadata of the file
+	FieldMetadata byte = 9
+	//FieldCommitment kind of the plaintext digest, keyed in new blocks
+	FieldCommitment byte = 10
+	//FieldAlgorithms identifiers of hash function and XOF of the ledger
+	FieldAlgorithms byte = 11
+)
+
+//kinds of author references
+const (
+	//AuthorIdentity the author is referenced by its registered identity
+	AuthorIdentity byte = 0
+	//AuthorPseudonym the author is referenced by a pseudonym
+	AuthorPseudonym byte = 1
+)
+
+//Block struct that contains the fields of a static block
+//a block is the concatenation of
+//digest of the previous block, digest of the ciphertext,
+//digest of the plaintext (or commitment, see FieldCommitment), control shard
+//followed by the optional fields, each encoded as
+//tag (1 byte), length (4 bytes big endian), value
+type Block struct {
+	Prev     []byte
+	CtDigest []byte
+	PtDigest []byte
+	Control  []byte
+	Fields   map[byte][]byte
+}
+
+//BlockOptions struct that contains the optional settings of a new block
+type BlockOptions struct {
+	//Author encoded reference to the author, nil for anonymous blocks
+	Author []byte
+	//Expiry epoch from which the block cannot be decrypted, 0 for no expiry
+	Expiry int64
+	//Sign if true the block is signed with the BLS key of the author
+	Sign bool
+	//Compress if true the file is compressed before encryption
+	Compress bool
+}
+
+//ToBytes encode a block
+//return the content of the block file
+func (block Block) ToBytes() []byte {
+	content := make([]byte, 0, 3*HashLen+PadSize)
+	content = append(content, block.Prev...)
+	content = append(content, block.CtDigest...)
+	content = append(content, block.PtDigest...)
+	content = append(content, block.Control...)
+	//optional fields sorted by tag
+	tags := make([]int, 0, len(block.Fields))
+	for tag := range block.Fields {
+		tags = append(tags, int(tag))
+	}
+	sort.Ints(tags)
+	for _, tag := range tags {
+		value := block.Fields[byte(tag)]
+		header := make([]byte, 5)
+		header[0] = byte(tag)
+		binary.BigEndian.PutUint32(header[1:], uint32(len(value)))
+		content = append(content, header...)
+		content = append(content, value...)
+	}
+	return content
+}
+
+//BlockFromBytes decode a block
+//content content of the block file
+//return the decoded block, nil if the content is malformed
+func BlockFromBytes(content []byte) *Block {
+	if len(content) < 3*HashLen+PadSize {
+		fmt.Println("Error decoding block: incomplete block!")
+		return nil
+	}
+	block := &Block{
+		Prev:     content[:HashLen],
+		CtDigest: content[HashLen : 2*HashLen],
+		PtDigest: content[2*HashLen : 3*HashLen],
+		Control:  content[3*HashLen : 3*HashLen+PadSize],
+		Fields:   make(map[byte][]byte),
+	}
+	//decode optional fields
+	rest := content[3*HashLen+PadSize:]
+	for len(rest) > 0 {
+		if len(rest) < 5 {
+			fmt.Println("Error decoding block: incomplete field!")
+			return nil
+		}
+		size := binary.BigEndian.Uint32(rest[1:])
+		if uint64(len(rest)-5) < uint64(size) {
+			fmt.Println("Error decoding block: incomplete field!")
+			return nil
+		}
+		if _, ok := block.Fields[rest[0]]; ok {
+			fmt.Println("Error decoding block: repeated field", rest[0])
+			return nil
+		}
+		block.Fields[rest[0]] = rest[5 : 5+size]
+		rest = rest[5+size:]
+	}
+	return block
+}
+
+//SignedContent encode the part of the block covered by the signature
+//return the encoding of the block without the signature field
+func (block Block) SignedContent() []byte {
+	unsigned := block
+	unsigned.Fields = make(map[byte][]byte, len(block.Fields))
+	for tag, value := range block.Fields {
+		if tag != FieldSignature {
+			unsigned.Fields[tag] = value
+		}
+	}
+	return unsigned.ToBytes()
+}
+
+//CheckSignature check the signature of the author of a block
+//the signing key must be the one registered by the author identity, if any,
+//and blocks of an identity with a registered signing key must be signed
+//registry registry of the ledger, see Ledger.ReadRegistry
+//return true if the signature is valid, or the block is not signed and
+//its author has no registered signing key
+func (block Block) CheckSignature(registry *Registry) bool {
+	sig, signed := block.Fields[FieldSignature]
+	signer := block.Fields[FieldSigner]
+	if !signed {
+		if author := block.Fields[FieldAuthor]; len(author) > 0 && author[0] == AuthorIdentity {
+			if reg := registry.Lookup(string(author[1:])); reg != nil && reg.SigningKey != nil {
+				fmt.Println("Block not signed by its author")
+				return false
+			}
+		}
+		return signer == nil
+	}
+	if !VerifySignature(signer, block.SignedContent(), sig) {
+		fmt.Println("Invalid block signature")
+		return false
+	}
+	return block.checkSigner(registry)
+}
+
+//checkSigner check that a block is signed by the registered key of its author
+//blocks with a pseudonymous or no author can be signed by any key
+//registry registry of the ledger, see Ledger.ReadRegistry
+//return true if the signing key matches the registry
+func (block Block) checkSigner(registry *Registry) bool {
+	if author := block.Fields[FieldAuthor]; len(author) > 0 && author[0] == AuthorIdentity {
+		reg := registry.Lookup(string(author[1:]))
+		if reg == nil || !bytes.Equal(reg.SigningKey, block.Fields[FieldSigner]) {
+			fmt.Println("Block not signed by the registered key of its author")
+			return false
+		}
+	}
+	return true
+}
+
+//BlockName compute the path of a block file
+//index index of the encapsulated key the block refers to
+//return the path of the block file, which has index+1 as name
+func (ledger Ledger) BlockName(index int64) string {
+	return ledger.RootPath + strconv.FormatInt(index+1, 16)
+}
+
+//GetBlock read a block from the ledger
+//index index of the encapsulated key the block refers to
+//return the decoded block, nil if it cannot be read
+func (ledger Ledger) GetBlock(index int64) *Block {
+	content, err := ioutil.ReadFile(ledger.BlockName(index))
+	if err != nil {
+		fmt.Println("File reading error", err)
+		return nil
+	}
+	return BlockFromBytes(content)
+}
+
+//WriteBlock write a new block on the ledger
+//index index of the encapsulated key the block refers to
+//block block to write
+//return true if the block was written successfully
+func (ledger Ledger) WriteBlock(index int64, block Block) bool {
+	//open file
+	file, err := os.OpenFile(ledger.BlockName(index), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	//close file on exit
+	defer func() {
+		if err = file.Close(); err != nil {
+			fmt.Println("Error closing file:", err)
+		}
+	}()
+	//write content
+	_, err = file.Write(block.ToBytes())
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
+}
+
+//IdentityAuthor encode a reference to a registered identity
+//identity identity of the author
+//return the encoded author reference
+func IdentityAuthor(identity string) []byte {
+	return append([]byte{AuthorIdentity}, identity...)
+}
+
+//PseudonymAuthor encode a reference to a pseudonym of an identity
+//the pseudonym is the digest of identity and salt: revealing the salt
+//links the block to the identity
+//identity identity of the author
+//salt secret salt kept by the author
+//return the encoded author reference
+func PseudonymAuthor(identity string, salt []byte) []byte {
+	h := Hash(append([]byte(identity), salt...))
+	return append([]byte{AuthorPseudonym}, h[:]...)
+}
+
+//RevealPseudonym check that a pseudonym belongs to an identity
+//author encoded author reference stored in the block
+//identity claimed identity of the author
+//salt salt revealed by the author
+//return true if the pseudonym corresponds to identity and salt
+func RevealPseudonym(author []byte, identity string, salt []byte) bool {
+	return bytes.Equal(author, PseudonymAuthor(identity, salt))
+}
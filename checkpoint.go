@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+)
+
+//ParamCheckpointed name of the parameter with the epoch of the first
+//checkpoint, once set the ledger must match a signed checkpoint
+const ParamCheckpointed = "checkpointed"
+
+//Checkpoint struct that contains the state of the ledger signed by the
+//filekeeper in the audit log
+type Checkpoint struct {
+	Epoch        int64
+	NumKeys      int64
+	HeadDigest   []byte
+	ShardsDigest []byte
+	KeysDigest   []byte
+}
+
+//KeysDigest compute the digest of the first keys of the key-file
+//numKeys number of keys to include
+//return the digest, nil if the key-file is shorter
+func (ledger Ledger) KeysDigest(numKeys int64) []byte {
+	content := make([]byte, numKeys*int64(Group.G1Len()))
+	if numKeys > 0 {
+		file, err := os.Open(ledger.KeysFile)
+		if err != nil {
+			fmt.Println("Error opening file:", err)
+			return nil
+		}
+		//close file on exit
+		defer func() {
+			if err = file.Close(); err != nil {
+				fmt.Println("Error closing file:", err)
+			}
+		}()
+		if _, err = io.ReadFull(file, content); err != nil {
+			fmt.Println("Error reading file:", err)
+			return nil
+		}
+	}
+	h := Hash(content)
+	return h[:]
+}
+
+//CurrentCheckpoint compute the checkpoint of the current state of the ledger
+//return the checkpoint, nil if some part of the ledger cannot be read
+func (ledger Ledger) CurrentCheckpoint() *Checkpoint {
+	epoch := ledger.Epoch()
+	numKeys := ledger.NumKeys()
+	if epoch < 0 || numKeys < 0 {
+		return nil
+	}
+	cp := &Checkpoint{
+		Epoch:        epoch,
+		NumKeys:      numKeys,
+		HeadDigest:   FileDigest(ledger.RootPath + strconv.FormatInt(numKeys, 16)),
+		ShardsDigest: FileDigest(ledger.ShardsFile),
+		KeysDigest:   ledger.KeysDigest(numKeys),
+	}
+	if cp.HeadDigest == nil || cp.ShardsDigest == nil || cp.KeysDigest == nil {
+		return nil
+	}
+	return cp
+}
+
+//ToBytes encode a checkpoint
+//return the payload of the audit entry
+func (cp Checkpoint) ToBytes() []byte {
+	encoded := append(encodeEpoch(cp.Epoch), encodeEpoch(cp.NumKeys)...)
+	encoded = append(encoded, cp.HeadDigest...)
+	encoded = append(encoded, cp.ShardsDigest...)
+	return append(encoded, cp.KeysDigest...)
+}
+
+//CheckpointFromBytes decode a checkpoint
+//encoded payload of the audit entry
+//return the checkpoint, nil if malformed
+func CheckpointFromBytes(encoded []byte) *Checkpoint {
+	if len(encoded) != 16+3*HashLen {
+		fmt.Println("Error decoding checkpoint: incomplete checkpoint!")
+		return nil
+	}
+	return &Checkpoint{
+		Epoch:        int64(binary.BigEndian.Uint64(encoded)),
+		NumKeys:      int64(binary.BigEndian.Uint64(encoded[8:])),
+		HeadDigest:   encoded[16 : 16+HashLen],
+		ShardsDigest: encoded[16+HashLen : 16+2*HashLen],
+		KeysDigest:   encoded[16+2*HashLen:],
+	}
+}
+
+//Checkpoint sign the current state of the ledger in the audit log
+//called after every operation of the filekeeper changing shards or keys
+//return true if the checkpoint was written, false if the filekeeper
+//has no signing key or the ledger cannot be read
+func (fk *FileKeeper) Checkpoint() bool {
+	if fk.signer == nil {
+		fmt.Println("Checkpoint not written: filekeeper without signing key")
+		return false
+	}
+	cp := fk.Ledger.CurrentCheckpoint()
+	if cp == nil || !fk.audit(AuditCheckpoint, cp.ToBytes()) {
+		return false
+	}
+	//record that the ledger is checkpointed, readers then require a checkpoint
+	params := fk.Ledger.ReadParams()
+	if params == nil {
+		return false
+	}
+	if _, ok := params[ParamCheckpointed]; !ok {
+		return fk.Ledger.SetParam(ParamCheckpointed, strconv.FormatInt(cp.Epoch, 10))
+	}
+	return true
+}
+
+//LastCheckpoint read the last checkpoint from the audit log
+//public public key of the filekeeper, nil to use the pinned key
+//of the Ledger struct
+//return the checkpoint, nil if there is none, no key is pinned
+//or its signature is not valid
+func (ledger Ledger) LastCheckpoint(public []byte) *Checkpoint {
+	if public == nil {
+		public = ledger.FileKeeperKey
+	}
+	if public == nil {
+		fmt.Println("Checkpoint not verified: filekeeper key not pinned")
+		return nil
+	}
+	entries := ledger.AuditEntries()
+	if entries == nil {
+		return nil
+	}
+	return lastCheckpoint(entries, public)
+}
+
+//lastCheckpoint find the last checkpoint of the audit entries
+//entries entries of the audit log
+//public public key of the filekeeper
+//return the checkpoint, nil if there is none or its signature is not valid
+func lastCheckpoint(entries []AuditEntry, public []byte) *Checkpoint {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Type != AuditCheckpoint {
+			continue
+		}
+		if !VerifySignature(public, entries[i].signedPart(), entries[i].Signature) {
+			fmt.Println("Invalid signature of checkpoint")
+			return nil
+		}
+		return CheckpointFromBytes(entries[i].Payload)
+	}
+	return nil
+}
+
+//checkpointLog audit log read by VerifyCheckpoint
+//the verification of the signature of the last checkpoint is valid only
+//for the key and the content of the audit log it was done with
+type checkpointLog struct {
+	public       string
+	digest       []byte
+	checkpointed bool
+	checkpoint   *Checkpoint
+}
+
+//verifiedCheckpoints last audit log read by VerifyCheckpoint, by audit file path
+var verifiedCheckpoints = struct {
+	sync.Mutex
+	byPath map[string]checkpointLog
+}{byPath: make(map[string]checkpointLog)}
+
+//readCheckpointLog read the last checkpoint of the audit log
+//the log is read once and identified by the digest of its content, the
+//signature of the checkpoint is verified only if the content or the key
+//changed since the previous call
+//public public key of the filekeeper, nil to skip the verification
+//return the log, nil if it cannot be read
+func (ledger Ledger) readCheckpointLog(public []byte) *checkpointLog {
+	content, err := ioutil.ReadFile(ledger.AuditFile)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("File reading error", err)
+		return nil
+	}
+	h := Hash(content)
+	log := checkpointLog{public: hex.EncodeToString(public), digest: h[:]}
+	verifiedCheckpoints.Lock()
+	cached, ok := verifiedCheckpoints.byPath[ledger.AuditFile]
+	verifiedCheckpoints.Unlock()
+	if ok && cached.public == log.public && bytes.Equal(cached.digest, log.digest) {
+		return &cached
+	}
+	records := decodeRecords(content)
+	if records == nil {
+		return nil
+	}
+	entries := make([]AuditEntry, len(records))
+	for i, record := range records {
+		entry := AuditEntryFromBytes(record)
+		if entry == nil {
+			return nil
+		}
+		entries[i] = *entry
+		log.checkpointed = log.checkpointed || entry.Type == AuditCheckpoint
+	}
+	if public != nil {
+		log.checkpoint = lastCheckpoint(entries, public)
+	}
+	verifiedCheckpoints.Lock()
+	verifiedCheckpoints.byPath[ledger.AuditFile] = log
+	verifiedCheckpoints.Unlock()
+	return &log
+}
+
+//VerifyCheckpoint check the ledger against the last checkpoint
+//detects substituted or rolled back shards and keys files:
+//the epoch, the shards file and the keys present at the checkpoint
+//must match, keys added afterwards must be chained to the head block
+//the key recorded in the parameters is not trusted: the checkpoint must be
+//signed by the given or pinned key, and a ledger that has ever been
+//checkpointed must match a checkpoint
+//the signature of the checkpoint is verified again only when the content
+//of the audit log changes, the files are compared with it on every call
+//public public key of the filekeeper, nil to use the pinned key
+//of the Ledger struct
+//return true if the ledger matches the checkpoint, or no key is pinned
+//and the ledger has never been checkpointed
+func (ledger Ledger) VerifyCheckpoint(public []byte) bool {
+	if public == nil {
+		public = ledger.FileKeeperKey
+	}
+	params := ledger.ReadParams()
+	log := ledger.readCheckpointLog(public)
+	if params == nil || log == nil {
+		return false
+	}
+	if _, checkpointed := params[ParamCheckpointed]; public == nil && !checkpointed && !log.checkpointed {
+		//ledgers without a signing filekeeper have no checkpoints
+		return true
+	}
+	cp := log.checkpoint
+	if cp == nil {
+		fmt.Println("No valid checkpoint of the ledger")
+		return false
+	}
+	switch {
+	case ledger.Epoch() != cp.Epoch:
+		fmt.Println("Ledger epoch does not match the last checkpoint")
+	case ledger.NumKeys() < cp.NumKeys:
+		fmt.Println("Keys file shorter than at the last checkpoint")
+	case !bytes.Equal(FileDigest(ledger.ShardsFile), cp.ShardsDigest):
+		fmt.Println("Shards file does not match the last checkpoint")
+	case !bytes.Equal(ledger.KeysDigest(cp.NumKeys), cp.KeysDigest):
+		fmt.Println("Keys file does not match the last checkpoint")
+	case !bytes.Equal(FileDigest(ledger.RootPath+strconv.FormatInt(cp.NumKeys, 16)), cp.HeadDigest):
+		fmt.Println("Head block does not match the last checkpoint")
+	default:
+		return true
+	}
+	return false
+}
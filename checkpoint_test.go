@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCheckpointPinnedKey(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	key := GenSigningKey()
+	ledger.FileKeeperKey = key.Public
+	fk.Ledger.FileKeeperKey = key.Public
+	//a pinned ledger without checkpoint is rejected
+	if ledger.VerifyCheckpoint(nil) {
+		t.Fatal("ledger without checkpoint accepted")
+	}
+	if !fk.SetSigner(key) || fk.SetSigner(GenSigningKey()) || !fk.Checkpoint() {
+		t.Fatal("signing key not pinned")
+	}
+	u := GenUser()
+	if u.AddBlock(ledger, fk.TokenGen(u.PublicKey), newTestFile(t, 200)) < 0 || fk.Update() == nil {
+		t.Fatal("block not added")
+	}
+	if !ledger.VerifyCheckpoint(nil) {
+		t.Fatal("checkpoint not verified")
+	}
+	//the key recorded in the parameters is not trusted
+	unpinned := ledger
+	unpinned.FileKeeperKey = nil
+	if unpinned.VerifyCheckpoint(nil) || ledger.VerifyCheckpoint(GenSigningKey().Public) {
+		t.Fatal("checkpoint verified without the pinned key")
+	}
+	//removing the audit log does not disable the checks
+	if err := os.Remove(ledger.AuditFile); err != nil {
+		t.Fatal(err)
+	}
+	if ledger.VerifyCheckpoint(nil) || unpinned.VerifyCheckpoint(nil) {
+		t.Fatal("missing checkpoint accepted")
+	}
+}
+
+func TestCheckpointCache(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	key := GenSigningKey()
+	ledger.FileKeeperKey = key.Public
+	fk.Ledger.FileKeeperKey = key.Public
+	u := GenUser()
+	if !fk.SetSigner(key) || u.AddBlock(ledger, fk.TokenGen(u.PublicKey), newTestFile(t, 200)) < 0 || !fk.Checkpoint() {
+		t.Fatal("checkpoint not written")
+	}
+	//the cached verification is dropped when a file changes, also if the
+	//size and the modification time are kept
+	for _, path := range []string{ledger.ShardsFile, ledger.KeysFile, ledger.AuditFile} {
+		if !ledger.VerifyCheckpoint(nil) || !ledger.VerifyCheckpoint(nil) {
+			t.Fatal("checkpoint not verified")
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content[len(content)-1] ^= 1
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, fi.ModTime(), fi.ModTime()); err != nil {
+			t.Fatal(err)
+		}
+		if ledger.VerifyCheckpoint(nil) {
+			t.Fatal("change of", path, "hidden by the cache")
+		}
+		content[len(content)-1] ^= 1
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//a key that is not pinned does not hit the cache
+	unpinned := ledger
+	unpinned.FileKeeperKey = nil
+	if !ledger.VerifyCheckpoint(nil) || unpinned.VerifyCheckpoint(nil) {
+		t.Fatal("cached verification used with another key")
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+//ChunksExt extension of the file with the chunk digests of a ciphertext
+const ChunksExt = ".chunks"
+
+//chunkKey derive the key of the chunk digests of a file, see fileKey
+//eps first masking shard of the file
+//key encryption key of the file
+//return the key
+func chunkKey(eps G2, key G1) []byte {
+	return fileKey(eps, key, "chunks")
+}
+
+//chunkLeaf compute the keyed digest of a plaintext chunk
+//key key of the chunk digests of the file
+//index index of the chunk
+//chunk plaintext chunk
+//return the digest
+func chunkLeaf(key []byte, index int64, chunk []byte) []byte {
+	encoded := make([]byte, len(key)+8, len(key)+8+len(chunk))
+	copy(encoded, key)
+	binary.BigEndian.PutUint64(encoded[len(key):], uint64(index))
+	h := Hash(append(encoded, chunk...))
+	return h[:]
+}
+
+//merkleRoot compute the root of the Merkle tree of the chunk digests
+//each node is the digest of its two children, an odd node is carried
+//to the next level unchanged
+//leaves chunk digests
+//return the root
+func merkleRoot(leaves [][]byte) []byte {
+	level := leaves
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i+1 < len(level); i += 2 {
+			h := Hash(append(append([]byte{}, level[i]...), level[i+1]...))
+			next = append(next, h[:])
+		}
+		if len(level)%2 == 1 {
+			next = append(next, level[len(level)-1])
+		}
+		level = next
+	}
+	return level[0]
+}
+
+//chunkLeaves compute the keyed digests of the chunks of a plaintext
+//fileName path to the plaintext
+//key key of the chunk digests of the file
+//return the digests, one for each chunk of PadSize bytes, nil on failure
+func chunkLeaves(fileName string, key []byte) [][]byte {
+	file, err := os.Open(fileName)
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return nil
+	}
+	defer file.Close()
+	var leaves [][]byte
+	buffer := make([]byte, PadSize)
+	for i := int64(0); ; i++ {
+		n, err := io.ReadFull(file, buffer)
+		if err == io.EOF && i > 0 {
+			break
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			fmt.Println("Error reading file:", err)
+			return nil
+		}
+		leaves = append(leaves, chunkLeaf(key, i, buffer[:n]))
+		if n < PadSize {
+			break
+		}
+	}
+	return leaves
+}
+
+//ChunksName compute the path of the chunk digests of a ciphertext
+//index index of the ciphertext
+//return the path of the file
+func (ledger Ledger) ChunksName(index int64) string {
+	return ledger.EncryptPath + strconv.FormatInt(index, 16) + ChunksExt
+}
+
+//writeLeaves write the chunk digests of a ciphertext
+//path path of the file
+//leaves chunk digests
+//return true if the digests were written
+func writeLeaves(path string, leaves [][]byte) bool {
+	if err := ioutil.WriteFile(path, bytes.Join(leaves, nil), 0644); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
+}
+
+//readLeaves read the chunk digests of a ciphertext
+//path path of the file
+//return the chunk digests, nil on failure
+func readLeaves(path string) [][]byte {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Println("File reading error", err)
+		return nil
+	}
+	if len(content) == 0 || len(content)%HashLen != 0 {
+		fmt.Println("Invalid chunk digests:", path)
+		return nil
+	}
+	leaves := make([][]byte, len(content)/HashLen)
+	for i := range leaves {
+		leaves[i] = content[i*HashLen : (i+1)*HashLen]
+	}
+	return leaves
+}
+
+//checkChunks check that the chunk digests of a block match its Merkle root
+//index index of the block
+//block block committing to the chunk digests
+//return true if the block has no chunk digests or they match
+func (ledger Ledger) checkChunks(index int64, block *Block) bool {
+	root, ok := block.Fields[FieldChunks]
+	if !ok {
+		return true
+	}
+	leaves := readLeaves(ledger.ChunksName(block.CiphertextIndex(index)))
+	return leaves != nil && bytes.Equal(merkleRoot(leaves), root)
+}
+
+//checkChain check that a block is chained to the following ones
+//the block must be linked to the previous block, and every following
+//block to its previous one, up to the last block of the ledger, whose
+//digest is signed in the checkpoint
+//index index of the block
+//return true if the links from the block to the last one are consistent
+func (ledger Ledger) checkChain(index int64) bool {
+	tot := ledger.NumKeys()
+	if tot < 0 || index >= tot {
+		return false
+	}
+	for i := index; i < tot; i++ {
+		block := ledger.GetBlock(i)
+		if block == nil {
+			return false
+		}
+		if !bytes.Equal(FileDigest(ledger.RootPath+strconv.FormatInt(i, 16)), block.Prev) {
+			fmt.Println("Block", i, "not linked to the previous block")
+			return false
+		}
+	}
+	return true
+}
+
+//DecryptRange decrypt a byte range of a file
+//only the chunks covering the range are decrypted, and each of them is
+//checked against the chunk digests committed in the block, which must
+//belong to the chain of the ledger;
+//compressed files cannot be decrypted by range
+//index index of the block of the file
+//	for shared keys it is the index of the first part of the shared key
+//unlocked unlocked key for decryption
+//offset position of the first byte to decrypt
+//length number of bytes to decrypt
+//return the decrypted bytes, nil on failure
+func (ledger Ledger) DecryptRange(index int64, unlocked G1, offset, length int64) []byte {
+	//check shards and keys files before decrypting
+	if !ledger.VerifyCheckpoint(nil) {
+		fmt.Println("Ledger does not match the last checkpoint!")
+		return nil
+	}
+	block := ledger.GetBlock(index)
+	if block == nil || !ledger.checkChain(index) {
+		return nil
+	}
+	if _, ok := block.Fields[FieldChunks]; !ok {
+		fmt.Println("Error decrypting range: block", index, "has no chunk digests")
+		return nil
+	}
+	if block.CompressionOf() != CompressNone {
+		fmt.Println("Error decrypting range: block", index, "is compressed")
+		return nil
+	}
+	if !ledger.checkChunks(index, block) {
+		fmt.Println("Error decrypting range: chunk digests do not match block", index)
+		return nil
+	}
+	ctIndex := block.CiphertextIndex(index)
+	leaves := readLeaves(ledger.ChunksName(ctIndex))
+	//read the ciphertext chunks covering the range
+	file, err := os.Open(ledger.EncryptPath + strconv.FormatInt(ctIndex, 16) + ".enc")
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return nil
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	if offset < 0 || length < 0 || offset+length > fi.Size() {
+		fmt.Println("Error decrypting range: range outside the file")
+		return nil
+	}
+	if length == 0 {
+		return []byte{}
+	}
+	pad := int64(PadSize)
+	first, last := offset/pad, (offset+length-1)/pad
+	if last >= int64(len(leaves)) {
+		fmt.Println("Error decrypting range: missing chunk digests")
+		return nil
+	}
+	end := (last + 1) * pad
+	if end > fi.Size() {
+		end = fi.Size()
+	}
+	ct := make([]byte, end-first*pad)
+	if _, err = file.ReadAt(ct, first*pad); err != nil {
+		fmt.Println("Error reading file:", err)
+		return nil
+	}
+	//decrypt and check each chunk
+	eps := ledger.Shard(0)
+	if eps == nil {
+		return nil
+	}
+	key := chunkKey(eps, unlocked)
+	defer Wipe(key)
+	pt := make([]byte, 0, len(ct))
+	for c := first; c <= last; c++ {
+		chunk := ct[(c-first)*pad:]
+		if int64(len(chunk)) > pad {
+			chunk = chunk[:pad]
+		}
+		if eps = ledger.Shard(c); eps == nil {
+			return nil
+		}
+		decrypted := OneTimePad(chunk, eps, unlocked)
+		if !bytes.Equal(chunkLeaf(key, c, decrypted), leaves[c]) {
+			fmt.Println("Error decrypting range: chunk", c, "does not match its digest")
+			return nil
+		}
+		pt = append(pt, decrypted...)
+	}
+	start := offset - first*pad
+	return pt[start : start+length]
+}
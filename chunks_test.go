@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDecryptRange(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	u := GenUser()
+	fileName := newTestFile(t, 1000)
+	plain, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := u.AddBlock(ledger, fk.TokenGen(u.PublicKey), fileName)
+	if index < 0 {
+		t.Fatal("block not added")
+	}
+	unlocked := u.UnlockKey(ledger.GetEncKey(index))
+	//ranges inside a chunk, across chunk boundaries and up to the end
+	pad := int64(PadSize)
+	for _, r := range [][2]int64{{0, 1}, {pad - 5, 10}, {pad, pad}, {pad - 1, 3*pad + 2}, {990, 10}, {0, 1000}, {500, 0}} {
+		got := ledger.DecryptRange(index, unlocked, r[0], r[1])
+		if !bytes.Equal(got, plain[r[0]:r[0]+r[1]]) {
+			t.Fatal("wrong decryption of range", r)
+		}
+	}
+	//ranges outside the file
+	for _, r := range [][2]int64{{-1, 10}, {0, -1}, {995, 10}, {1000, 1}} {
+		if ledger.DecryptRange(index, unlocked, r[0], r[1]) != nil {
+			t.Fatal("range outside the file decrypted", r)
+		}
+	}
+}
+
+func TestDecryptRangeTampered(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	u := GenUser()
+	token := fk.TokenGen(u.PublicKey)
+	first := u.AddBlock(ledger, token, newTestFile(t, 500))
+	index := u.AddBlock(ledger, token, newTestFile(t, 500))
+	if first < 0 || index < 0 {
+		t.Fatal("block not added")
+	}
+	unlocked := u.UnlockKey(ledger.GetEncKey(index))
+	//a tampered chunk is rejected, the others are still decrypted
+	ctName := ledger.EncryptPath + "1.enc"
+	ct, err := ioutil.ReadFile(ctName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad := int64(PadSize)
+	ct[2*pad+1] ^= 1
+	if err = ioutil.WriteFile(ctName, ct, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ledger.DecryptRange(index, unlocked, 2*pad, 10) != nil || ledger.DecryptRange(index, unlocked, pad, 2*pad) != nil {
+		t.Fatal("tampered chunk decrypted")
+	}
+	if ledger.DecryptRange(index, unlocked, 0, pad) == nil {
+		t.Fatal("untouched chunk not decrypted")
+	}
+	//a block whose previous block was replaced does not belong to the chain
+	prev, err := ioutil.ReadFile(ledger.BlockName(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(ledger.BlockName(first), append(prev, 0), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ledger.DecryptRange(index, unlocked, 0, pad) != nil {
+		t.Fatal("block out of the chain decrypted")
+	}
+}
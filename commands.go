@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//environment variable that can provide the keystore passphrase
+const passphraseEnv string = "PLSD_PASSPHRASE"
+
+//ReadPassphrase read the keystore passphrase
+//taken from the environment variable PLSD_PASSPHRASE if set,
+//otherwise asked on standard input
+//prompt message shown to the user
+//return the passphrase
+func ReadPassphrase(prompt string) string {
+	if pass, ok := os.LookupEnv(passphraseEnv); ok {
+		return pass
+	}
+	fmt.Print(prompt)
+	reader := bufio.NewReader(os.Stdin)
+	pass, _ := reader.ReadString('\n')
+	return strings.TrimRight(pass, "\r\n")
+}
+
+//KeystoreCommand manage the identities in the keystore
+//ks keystore to manage
+//args command arguments:
+//	create NAME: generate a new identity
+//	list: list identities and their public keys
+//	backup NAME OUT: copy the encrypted identity to OUT
+//	restore NAME IN: add the identity saved in IN as NAME
+func KeystoreCommand(ks Keystore, args []string) {
+	usage := "usage: keystore create NAME | list | backup NAME OUT | restore NAME IN"
+	if len(args) == 0 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+	switch {
+	case args[0] == "create" && len(args) == 2:
+		pass := ReadPassphrase("Passphrase for " + args[1] + ": ")
+		u := ks.Create(args[1], pass)
+		if u == nil {
+			os.Exit(1)
+		}
+		u.Destroy()
+		fmt.Println("Created identity", args[1], "in", ks.KeyPath(args[1]))
+	case args[0] == "list" && len(args) == 1:
+		ids := ks.List()
+		names := make([]string, 0, len(ids))
+		for name := range ids {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name, ids[name])
+		}
+	case args[0] == "backup" && len(args) == 3:
+		if !ks.Backup(args[1], args[2]) {
+			os.Exit(1)
+		}
+		fmt.Println("Identity", args[1], "saved to", args[2])
+	case args[0] == "restore" && len(args) == 3:
+		if !ks.Restore(args[1], args[2]) {
+			os.Exit(1)
+		}
+		fmt.Println("Identity", args[1], "restored from", args[2])
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
+
+//RegisterCommand register an identity of the keystore on the ledger
+//ledger struct with file paths of the ledger
+//ks keystore containing the identity
+//args command arguments: NAME identity to register
+func RegisterCommand(ledger Ledger, ks Keystore, args []string) {
+	if len(args) != 1 {
+		fmt.Println("usage: register NAME")
+		os.Exit(2)
+	}
+	u := ks.Load(args[0], ReadPassphrase("Passphrase for "+args[0]+": "))
+	if u == nil {
+		os.Exit(1)
+	}
+	registered := ledger.Register(args[0], *u)
+	u.Destroy()
+	if !registered {
+		os.Exit(1)
+	}
+	fmt.Println("Registered identity", args[0], "on", ledger.RegistryFile)
+}
+
+//RegistryCommand print registrations and revocations recorded on the ledger
+//only revocations signed by the filekeeper are printed
+//ledger struct with file paths of the ledger
+//args command arguments: [PUBKEY] hex encoded public key of the filekeeper,
+//by default the one pinned in the settings or recorded in the ledger parameters
+func RegistryCommand(ledger Ledger, args []string) {
+	if len(args) > 1 {
+		fmt.Println("usage: registry [PUBKEY]")
+		os.Exit(2)
+	}
+	public := ledger.FileKeeperKey
+	if public == nil {
+		public = ledger.RecordedFileKeeperKey()
+	}
+	if len(args) == 1 {
+		public = decodeSigPub(args[0])
+	}
+	if public == nil {
+		os.Exit(2)
+	}
+	registry, revs := ledger.ReadRegistry(), ledger.Revocations(public)
+	if registry == nil || revs == nil || !registry.Check() {
+		os.Exit(1)
+	}
+	for _, reg := range registry.Registrations {
+		fmt.Println("registered", reg.Identity, keyID(reg.PublicKey))
+	}
+	for _, rev := range revs {
+		fmt.Println("revoked at epoch", rev.Epoch, keyID(rev.PublicKey))
+	}
+}
+
+//RevokeCommand revoke the write access of a registered identity
+//the revocation is signed with the key of the filekeeper in the keystore
+//and recorded on the ledger, running filekeepers read it on the next token
+//ledger struct with file paths of the ledger
+//ks keystore containing the filekeeper identity
+//args command arguments: NAME identity to revoke
+func RevokeCommand(ledger Ledger, ks Keystore, args []string) {
+	if len(args) != 1 {
+		fmt.Println("usage: revoke NAME")
+		os.Exit(2)
+	}
+	reg := ledger.LookupIdentity(args[0])
+	if reg == nil {
+		fmt.Println("Identity not registered:", args[0])
+		os.Exit(1)
+	}
+	signer := ks.FileKeeperSigner(ReadPassphrase("Passphrase for " + FileKeeperIdentity + ": "))
+	if signer == nil {
+		os.Exit(1)
+	}
+	//the time-key is not needed to revoke
+	fk := NewFileKeeper(ledger, nil)
+	if !fk.SetSigner(signer) || !fk.Revoke(reg.PublicKey) {
+		os.Exit(1)
+	}
+	fmt.Println("Revoked identity", args[0])
+}
+
+//AuditCommand verify and print the audit log of the filekeeper
+//ledger struct with file paths of the ledger
+//args command arguments: [PUBKEY] hex encoded public key of the filekeeper,
+//by default the one pinned in the settings or recorded in the ledger parameters
+func AuditCommand(ledger Ledger, args []string) {
+	if len(args) > 1 {
+		fmt.Println("usage: audit [PUBKEY]")
+		os.Exit(2)
+	}
+	var public []byte
+	if len(args) == 1 {
+		if public = decodeSigPub(args[0]); public == nil {
+			os.Exit(2)
+		}
+	}
+	n := ledger.VerifyAudit(public)
+	if n < 0 {
+		fmt.Println("Audit log NOT valid")
+		os.Exit(1)
+	}
+	for _, entry := range ledger.AuditEntries() {
+		fmt.Println(entry)
+	}
+	fmt.Println("Audit log valid:", n, "entries")
+}
+
+//SignaturesCommand verify the signatures of a range of blocks at once
+//ledger struct with file paths of the ledger
+//args command arguments: [FROM [TO]] range of block indices, by default
+//all the blocks of the ledger
+func SignaturesCommand(ledger Ledger, args []string) {
+	if len(args) > 2 {
+		fmt.Println("usage: signatures [FROM [TO]]")
+		os.Exit(2)
+	}
+	bounds := []int64{0, ledger.NumKeys() - 1}
+	for i, arg := range args {
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || n < 0 {
+			fmt.Println("Invalid block index:", arg)
+			os.Exit(2)
+		}
+		bounds[i] = n
+	}
+	n := ledger.AuditSignatures(bounds[0], bounds[1])
+	if n < 0 {
+		fmt.Println("Block signatures NOT valid")
+		os.Exit(1)
+	}
+	fmt.Println("Block signatures valid:", n, "signed blocks")
+}
+
+//parseSizes parse a comma separated list of positive integers
+//list list to parse
+//return the integers, nil if the list is not valid
+func parseSizes(list string) []int {
+	sizes := []int{}
+	for _, field := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 {
+			fmt.Println("Invalid size:", field)
+			return nil
+		}
+		sizes = append(sizes, n)
+	}
+	return sizes
+}
+
+//BenchCommand measure the operations of the ledger, or compare two reports
+//the ledgers are created in a temporary folder with the pairing group
+//and the algorithms of the settings
+//args command arguments:
+//	[-pads LIST] [-shards LIST] [-sizes LIST] [-workers LIST] [-rounds N] [-dir DIR] OUT:
+//	run the benchmarks and write the report to OUT, LIST is comma separated
+//	compare OLD NEW: compare the measurements of two reports
+func BenchCommand(args []string) {
+	usage := "usage: bench [-pads LIST] [-shards LIST] [-sizes LIST] [-workers LIST] [-rounds N] [-dir DIR] OUT | compare OLD NEW"
+	if len(args) == 3 && args[0] == "compare" {
+		old, new := ReadBenchReport(args[1]), ReadBenchReport(args[2])
+		if old == nil || new == nil {
+			os.Exit(1)
+		}
+		for _, line := range CompareBench(*old, *new) {
+			fmt.Println(line)
+		}
+		return
+	}
+	config := DefaultBench
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	lists := map[string]*[]int{"pads": &config.PadSizes, "shards": &config.ShardCounts, "sizes": &config.FileSizes, "workers": &config.Workers}
+	values := make(map[string]*string)
+	for name := range lists {
+		values[name] = flags.String(name, "", "comma separated list of "+name)
+	}
+	flags.IntVar(&config.Rounds, "rounds", config.Rounds, "repetitions of each operation")
+	dir := flags.String("dir", "", "folder of the temporary ledgers")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+	for name, list := range values {
+		if *list == "" {
+			continue
+		}
+		if *lists[name] = parseSizes(*list); *lists[name] == nil {
+			os.Exit(2)
+		}
+	}
+	report := RunBench(config, *dir)
+	if report == nil || !WriteBenchReport(*report, flags.Arg(0)) {
+		os.Exit(1)
+	}
+	fmt.Println("Benchmark report written to", flags.Arg(0))
+}
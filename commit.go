@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+//kinds of plaintext digests of a block
+const (
+	//CommitDigest the plaintext digest is the plain digest of the file,
+	//blocks without commitment field
+	CommitDigest byte = 0
+	//CommitKeyed the plaintext digest is keyed with a secret derived from the
+	//encryption key of the file, known only to whoever can decrypt the file
+	CommitKeyed byte = 1
+)
+
+//CommitmentOf decode the commitment field of a block
+//return the kind of plaintext digest of the block, 0xff if unknown
+func (block Block) CommitmentOf() byte {
+	encoded, ok := block.Fields[FieldCommitment]
+	if !ok {
+		return CommitDigest
+	}
+	if len(encoded) != 1 || encoded[0] != CommitKeyed {
+		return 0xff
+	}
+	return encoded[0]
+}
+
+//commitmentKey derive the key of the plaintext commitment of a file,
+//see fileKey
+//eps first masking shard of the file
+//key encryption key of the file
+//return the key
+func commitmentKey(eps G2, key G1) []byte {
+	return fileKey(eps, key, "commitment")
+}
+
+//PlaintextCommitment compute the hiding commitment to a plaintext
+//without the key, the commitment does not allow to confirm guesses
+//of the content of the file
+//fileName path to the plaintext
+//eps first masking shard of the file
+//key encryption key of the file
+//return the commitment, nil on failure
+func PlaintextCommitment(fileName string, eps G2, key G1) []byte {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		fmt.Println("File reading error", err)
+		return nil
+	}
+	commitKey := commitmentKey(eps, key)
+	input := append(commitKey, data...)
+	h := Hash(input)
+	Wipe(commitKey)
+	Wipe(input[:len(commitKey)])
+	return h[:]
+}
+
+//PlaintextDigest compute the plaintext digest of a block for a decrypted file
+//the value can be compared by CheckConsistency with the one in the block
+//index index of the block
+//unlocked unlocked key of the block
+//fileName path to the decrypted file
+//return the digest or commitment of the file, nil on failure
+func (ledger Ledger) PlaintextDigest(index int64, unlocked G1, fileName string) []byte {
+	block := ledger.GetBlock(index)
+	if block == nil {
+		return nil
+	}
+	switch block.CommitmentOf() {
+	case CommitDigest:
+		return FileDigest(fileName)
+	case CommitKeyed:
+		eps := ledger.Shard(0)
+		if eps == nil {
+			return nil
+		}
+		return PlaintextCommitment(fileName, eps, unlocked)
+	}
+	fmt.Println("Unknown commitment of block", index)
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFileKeysIndependentOfPads(t *testing.T) {
+	ledger, fk := newTestLedger(t, 4)
+	u := GenUser()
+	key := fk.TokenGen(u.PublicKey).Mul(GenExp())
+	eps := ledger.GetSingleShard(0)
+	//the first pad leaks to whoever knows the start of the plaintext
+	pad := HashAte(eps, key)
+	keys := [][]byte{commitmentKey(eps, key), chunkKey(eps, key), fileKey(eps, key, "metadata")}
+	for i, derived := range keys {
+		for _, tag := range []string{"commitment", "chunks", "metadata"} {
+			h := Hash(append([]byte(tag), pad...))
+			if bytes.Equal(derived, h[:]) {
+				t.Fatal("key derived from the pad with tag", tag)
+			}
+		}
+		if bytes.Contains(pad, derived[:16]) {
+			t.Fatal("key overlaps the pad")
+		}
+		for _, other := range keys[:i] {
+			if bytes.Equal(derived, other) {
+				t.Fatal("keys with different tags are equal")
+			}
+		}
+	}
+	//the keys do not change with the updates
+	index := u.AddBlock(ledger, fk.TokenGen(u.PublicKey), newTestFile(t, 100))
+	if index < 0 {
+		t.Fatal("block not added")
+	}
+	before := commitmentKey(ledger.Shard(0), u.UnlockKey(ledger.GetEncKey(index)))
+	if fk.Update() == nil {
+		t.Fatal("update failed")
+	}
+	if !bytes.Equal(before, commitmentKey(ledger.Shard(0), u.UnlockKey(ledger.GetEncKey(index)))) {
+		t.Fatal("commitment key changed with the update")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+//compression algorithms of the plaintexts
+const (
+	//CompressNone the plaintext is encrypted as is
+	CompressNone byte = 0
+	//CompressFlate the plaintext is compressed with DEFLATE before encryption
+	CompressFlate byte = 1
+)
+
+//CompressionOf decode the compression field of a block
+//return the compression algorithm of the plaintext, 0xff if unknown
+func (block Block) CompressionOf() byte {
+	encoded, ok := block.Fields[FieldCompression]
+	if !ok {
+		return CompressNone
+	}
+	if len(encoded) != 1 || encoded[0] != CompressFlate {
+		return 0xff
+	}
+	return encoded[0]
+}
+
+//compressFile compress a file in a temporary file
+//the temporary file is not in the ledger, since it contains the plaintext
+//fileName path to the file to compress
+//return the path of the compressed file, "" on failure
+func compressFile(fileName string) string {
+	in, err := os.Open(fileName)
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return ""
+	}
+	defer in.Close()
+	out, err := ioutil.TempFile("", "plsd-*.flate")
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	writer, err := flate.NewWriter(out, flate.BestCompression)
+	if err == nil {
+		if _, err = io.Copy(writer, in); err == nil {
+			err = writer.Close()
+		}
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Println("Error compressing file:", err)
+		os.Remove(out.Name())
+		return ""
+	}
+	return out.Name()
+}
+
+//decompressFile decompress a file in place
+//fileName path to the compressed file
+//return true if the file was decompressed
+func decompressFile(fileName string) bool {
+	in, err := os.Open(fileName)
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return false
+	}
+	defer in.Close()
+	temp := fileName + ".tmp"
+	out, err := os.Create(temp)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	reader := flate.NewReader(in)
+	_, err = io.Copy(out, reader)
+	if rerr := reader.Close(); err == nil {
+		err = rerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(temp, fileName)
+	}
+	if err != nil {
+		fmt.Println("Error decompressing file:", err)
+		os.Remove(temp)
+		return false
+	}
+	return true
+}
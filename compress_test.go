@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	u := GenUser()
+	token := fk.TokenGen(u.PublicKey)
+	//a compressible file larger than the shards of the ledger
+	plain := bytes.Repeat([]byte("private ledger "), 200)
+	fileName := filepath.Join(t.TempDir(), "plaintext")
+	if err := ioutil.WriteFile(fileName, plain, 0644); err != nil {
+		t.Fatal(err)
+	}
+	index := u.AddBlockWith(ledger, token, fileName, BlockOptions{Compress: true})
+	if index < 0 || ledger.GetBlock(index).CompressionOf() != CompressFlate {
+		t.Fatal("compressed block not added")
+	}
+	unlocked := u.UnlockKey(ledger.GetEncKey(index))
+	out := filepath.Join(t.TempDir(), "decrypted")
+	ledger.DecryptBlock(index, unlocked, out)
+	decrypted, err := ioutil.ReadFile(out)
+	if err != nil || !bytes.Equal(decrypted, plain) {
+		t.Fatal("compressed block not decrypted")
+	}
+	//compressed blocks cannot be decrypted by range
+	if ledger.DecryptRange(index, unlocked, 0, 10) != nil {
+		t.Fatal("compressed block decrypted by range")
+	}
+}
+
+func TestDecompressInvalid(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	u := GenUser()
+	index := u.AddBlock(ledger, fk.TokenGen(u.PublicKey), newTestFile(t, 500))
+	if index < 0 {
+		t.Fatal("block not added")
+	}
+	//a block marked as compressed whose plaintext is not DEFLATE
+	block := ledger.GetBlock(index)
+	block.Fields[FieldCompression] = []byte{CompressFlate}
+	if !ledger.WriteBlock(index, *block) {
+		t.Fatal("block not written")
+	}
+	unlocked := u.UnlockKey(ledger.GetEncKey(index))
+	out := filepath.Join(t.TempDir(), "decrypted")
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("invalid compressed block decrypted")
+			}
+		}()
+		ledger.DecryptBlock(index, unlocked, out)
+	}()
+	//the file is left as it was
+	content, err := ioutil.ReadFile(newTestFile(t, 300))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(out, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if decompressFile(out) {
+		t.Fatal("invalid DEFLATE stream decompressed")
+	}
+	if after, err := ioutil.ReadFile(out); err != nil || !bytes.Equal(after, content) {
+		t.Fatal("file changed by a failed decompression")
+	}
+	if _, err = os.Stat(out + ".tmp"); !os.IsNotExist(err) {
+		t.Fatal("temporary file left")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+//malformedSeeds add to a fuzz test the encodings of valid and malformed points
+func malformedSeeds(f *testing.F) {
+	for _, group := range PairingGroups {
+		for _, valid := range [][]byte{group.G1Generator().Bytes(), group.G2Generator().Bytes()} {
+			f.Add(valid)
+			f.Add(valid[:len(valid)-1])
+			f.Add(make([]byte, len(valid)))
+			f.Add(append([]byte{0x04}, valid[1:]...))
+			f.Add(bytes.Repeat([]byte{0xff}, len(valid)))
+			f.Add(append([]byte{valid[0]}, bytes.Repeat([]byte{0xff}, len(valid)-1)...))
+		}
+	}
+	f.Add([]byte{})
+}
+
+func FuzzDecodePoints(f *testing.F) {
+	malformedSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, group := range PairingGroups {
+			//decoded points are canonical and never the identity
+			if P := group.G1FromBytes(data); P != nil && (P.IsIdentity() || !bytes.Equal(P.Bytes(), data)) {
+				t.Fatalf("%s: non-canonical G1 encoding accepted", group.Name())
+			}
+			if Q := group.G2FromBytes(data); Q != nil && (Q.IsIdentity() || !bytes.Equal(Q.Bytes(), data)) {
+				t.Fatalf("%s: non-canonical G2 encoding accepted", group.Name())
+			}
+		}
+	})
+}
+
+func FuzzLedgerFiles(f *testing.F) {
+	malformedSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ledger, fk := newTestLedger(t, 4)
+		u := GenUser()
+		if u.AddBlock(ledger, fk.TokenGen(u.PublicKey), newTestFile(t, 200)) < 0 {
+			t.Fatal("block not added")
+		}
+		//the data replace the start of the shards file and the key of the block
+		shards, err := ioutil.ReadFile(ledger.ShardsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append([]byte{}, data...)
+		if len(data) < len(shards) {
+			data = append(data, shards[len(data):]...)
+		}
+		size := Group.G1Len()
+		files := map[string][]byte{ledger.KeysFile: data[:size], ledger.ShardsFile: data}
+		for path, content := range files {
+			if err := ioutil.WriteFile(path, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		//invalid values are rejected, never decoded
+		if keyEnc := ledger.GetEncKey(0); keyEnc != nil && !bytes.Equal(keyEnc.Bytes(), data[:size]) {
+			t.Fatal("invalid encapsulated key accepted")
+		}
+		if eps := ledger.GetSingleShard(0); eps != nil && !bytes.Equal(eps.Bytes(), data[:Group.G2Len()]) {
+			t.Fatal("invalid masking shard accepted")
+		}
+		if shards := ledger.GetShards(MaxShards); shards != nil {
+			for i, eps := range shards {
+				if eps == nil || !bytes.Equal(eps.Bytes(), data[i*Group.G2Len():(i+1)*Group.G2Len()]) {
+					t.Fatal("invalid masking shard accepted")
+				}
+			}
+		}
+		if ledger.ShardRange(MaxShards) == nil != (ledger.GetShards(MaxShards) == nil) {
+			t.Fatal("shard cache and shards file disagree")
+		}
+		ledger.CheckConsistency(-1, nil)
+		//an update either succeeds or leaves the files untouched
+		if fk.Update() == nil {
+			for path, content := range files {
+				if current, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(current, content) {
+					t.Fatal("failed update changed", path)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+//encodeEpoch encode an epoch as 8 bytes big endian
+func encodeEpoch(epoch int64) []byte {
+	encoded := make([]byte, 8)
+	binary.BigEndian.PutUint64(encoded, uint64(epoch))
+	return encoded
+}
+
+//ExpiryOf decode the expiry field of a block
+//return the epoch from which the block cannot be decrypted,
+//0 if the block does not expire
+func (block Block) ExpiryOf() int64 {
+	encoded, ok := block.Fields[FieldExpiry]
+	if !ok || len(encoded) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(encoded))
+}
+
+//expiredTombstone build the tombstone of an expired key
+//epoch epoch in which the key has been removed
+//return the tombstone
+func expiredTombstone(epoch int64) []byte {
+	tombstone := make([]byte, Group.G1Len())
+	tombstone[0] = TombstoneExpired
+	copy(tombstone[1:], encodeEpoch(epoch))
+	return tombstone
+}
+
+//expiries read the expiry of every block of the ledger
+//numKey number of encapsulated keys (and therefore blocks) present
+//a missing block is a failure, its key would otherwise never expire
+//return map from the index of expiring blocks to their expiry,
+//nil if some block cannot be read
+func (ledger Ledger) expiries(numKey int) map[int]int64 {
+	result := make(map[int]int64)
+	for i := 0; i < numKey; i++ {
+		block := ledger.GetBlock(int64(i))
+		if block == nil {
+			return nil
+		}
+		if expiry := block.ExpiryOf(); expiry > 0 {
+			result[i] = expiry
+		}
+	}
+	return result
+}
+
+//checkExpiry check that a key is removed if and only if its block is expired
+//record record of the key-file, encapsulated key or tombstone
+//block block of the key
+//epoch current epoch of the ledger
+//return true if the record is consistent with the expiry of the block
+func checkExpiry(record []byte, block *Block, epoch int64) bool {
+	expiry := block.ExpiryOf()
+	if IsTombstone(record) {
+		if record[0] != TombstoneExpired {
+			return true
+		}
+		removed := int64(binary.BigEndian.Uint64(record[1:9]))
+		if expiry == 0 || removed < expiry || removed > epoch {
+			fmt.Println("Tombstone inconsistent with expiry of the block")
+			return false
+		}
+		return true
+	}
+	if expiry > 0 && expiry <= epoch {
+		fmt.Println("Expired key still present in the ledger")
+		return false
+	}
+	return true
+}
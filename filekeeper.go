@@ -5,20 +5,124 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"strconv"
 	"sync"
-
-	curve "github.com/gaetanorusso/public_ledger_sensitive_data/miracl/go/core/BN254"
+	"time"
 )
 
 //Ledger struct that contains file names of the parts of the ledger
+//and the source of randomness of Init and Update, crypto/rand if nil
+//FileKeeperKey is the pinned BLS public key of the filekeeper the
+//checkpoints are verified with, nil if not pinned
 type Ledger struct {
-	ShardsFile  string
-	KeysFile    string
-	RootPath    string
-	EncryptPath string
+	ShardsFile    string
+	KeysFile      string
+	RootPath      string
+	EncryptPath   string
+	RegistryFile  string
+	ParamsFile    string
+	AuditFile     string
+	FileKeeperKey []byte
+	Rand          io.Reader
+}
+
+//FileKeeper struct that contains the state of the filekeeper
+//the filekeeper holds the secret time-key of the ledger,
+//the list of revoked public keys and the key signing the audit log
+//if RequireRegistration is set tokens are issued only to registered users;
+//any user can register a key it proves to own, so registration makes writers
+//accountable rather than authorising them, access is withdrawn by revocation
+//Rand is the source of randomness of updates and new shards, crypto/rand if nil
+//the time-key and the revocation list are guarded by stateMu, so that tokens
+//can be issued concurrently with updates and revocations
+type FileKeeper struct {
+	Ledger              Ledger
+	RequireRegistration bool
+	Rand                io.Reader
+	s                   Scalar
+	revoked             map[string]bool
+	stateMu             sync.RWMutex
+	signer              *SigningKey
+	auditHead           []byte
+	auditMu             sync.Mutex
+}
+
+//NewFileKeeper create the filekeeper of a ledger
+//the revocation list is empty until the signing key is set, see SetSigner,
+//the revocations recorded on the ledger are checked anyway on every token
+//ledger struct with file paths of the ledger
+//s current time-key, as returned by Init; the filekeeper takes ownership
+//of it: Update wipes it and Destroy wipes the current one, so the caller
+//must not use it afterwards
+//return the filekeeper
+func NewFileKeeper(ledger Ledger, s Scalar) *FileKeeper {
+	return &FileKeeper{Ledger: ledger, s: s, revoked: make(map[string]bool)}
+}
+
+//TokenGen generate the encryption token for a user
+//the revocations recorded on the ledger are read on every call
+//pubKey public key of the user that requested the token
+//return the encryption token, nil if the user is not allowed to write
+func (fk *FileKeeper) TokenGen(pubKey G1) G1 {
+	fk.stateMu.RLock()
+	defer fk.stateMu.RUnlock()
+	if fk.s == nil {
+		fmt.Println("Token refused: time-key not available")
+		return nil
+	}
+	if fk.isRevoked(pubKey) {
+		fmt.Println("Token refused: public key revoked")
+		return nil
+	}
+	if fk.RequireRegistration && !fk.Ledger.IsRegistered(pubKey) {
+		fmt.Println("Token refused: public key not registered")
+		return nil
+	}
+	epoch := fk.Ledger.Epoch()
+	if epoch < 0 || !fk.audit(AuditToken, keyFingerprint(pubKey), encodeEpoch(epoch)) {
+		return nil
+	}
+	return TokenGen(pubKey, fk.s)
+}
+
+//Update update shards and keys of the ledger with a new time-key
+//the previous time-key is wiped
+//return new time-key, nil if the update failed or could not be recorded
+//in the audit log; in the latter case the ledger has been updated and the
+//filekeeper keeps the new time-key
+func (fk *FileKeeper) Update() Scalar {
+	//the audit entries describe the state left by the update
+	unlock := fk.Ledger.Lock()
+	if unlock == nil {
+		return nil
+	}
+	defer unlock()
+	fk.stateMu.Lock()
+	defer fk.stateMu.Unlock()
+	if fk.s == nil {
+		fmt.Println("Update refused: time-key not available")
+		return nil
+	}
+	epoch := fk.Ledger.Epoch()
+	startTime := time.Now()
+	sNew := fk.Ledger.update(fk.s, fk.Rand)
+	if sNew == nil {
+		return nil
+	}
+	//the previous time-key is not needed anymore
+	fk.s.Wipe()
+	fk.s = sNew
+	duration := time.Now().Sub(startTime)
+	if !fk.audit(AuditUpdate, encodeEpoch(epoch), encodeEpoch(fk.Ledger.Epoch()),
+		encodeEpoch(int64(fk.Ledger.NumShards())), encodeEpoch(fk.Ledger.NumKeys()), encodeEpoch(int64(duration))) {
+		return nil
+	}
+	//sign the new state of the ledger
+	if fk.signer != nil && !fk.Checkpoint() {
+		return nil
+	}
+	return sNew
 }
 
 //CheckConsistency check the consistency of a ledger and correct decryption
@@ -26,13 +130,15 @@ type Ledger struct {
 //	if > 0 the static ledger is checked up to this index
 //	use negative value to check only static ledger consistency
 //ptDigest hash of the decrypted file to check, used only if index >=0
+//	for blocks with a keyed commitment see Ledger.PlaintextDigest
 //return true if the static ledger up to index is consistent and the digest
 //in input corresponds of the plaintext digest in the block
 //if index < 0 just the consistency of the static blocks (all of them) is checked
-//the consistency of encapsulated keys and masking shards is always checked
+//the consistency of encapsulated keys and masking shards, and the registry,
+//are always checked
 func (ledger Ledger) CheckConsistency(target int64, ptDigest []byte) bool {
-	//check up to target if >= 0, otherwise check all blocks
-	tot := target
+	//check up to target included if >= 0, otherwise check all blocks
+	tot := target + 1
 	if target < 0 {
 		//compute number of keys (and therefore blocks) present
 		fi, err := os.Stat(ledger.KeysFile)
@@ -40,38 +146,86 @@ func (ledger Ledger) CheckConsistency(target int64, ptDigest []byte) bool {
 			fmt.Println(err)
 			return false
 		}
-		tot = fi.Size() / int64(curve.MODBYTES+1)
+		tot = fi.Size() / int64(Group.G1Len())
+	}
+	//current epoch, to check expired blocks
+	epoch := ledger.Epoch()
+	if epoch < 0 {
+		return false
+	}
+	//the authors of the blocks are checked against the registry,
+	//read and verified once
+	registry := ledger.ReadRegistry()
+	if registry == nil || !registry.Check() {
+		return false
+	}
+	//only the control shards are read, through the shard cache
+	segments := ledger.ShardSegments()
+	if segments == nil {
+		return false
 	}
-	//read masking shards from file
-	eps := ledger.GetShards(MaxShards)
 	//check blocks consistency one by one
 	for i := int64(0); i < tot; i++ {
-		filename := ledger.RootPath + strconv.FormatInt(i+1, 16)
-		content, err := ioutil.ReadFile(filename)
-		if err != nil {
-			fmt.Println("File reading error", err)
+		block := ledger.GetBlock(i)
+		if block == nil {
 			return false
 		}
 		//check link with previous block
 		prevDigest := FileDigest(ledger.RootPath + strconv.FormatInt(i, 16))
-		if !bytes.Equal(prevDigest, content[:HashLen]) {
+		if !bytes.Equal(prevDigest, block.Prev) {
 			return false
 		}
-		//check hash of encrypted file
-		ctName := ledger.EncryptPath + strconv.FormatInt(i, 16) + ".enc"
+		//check hash of encrypted file, shares refer to the shared ciphertext
+		ctName := ledger.EncryptPath + strconv.FormatInt(block.CiphertextIndex(i), 16) + ".enc"
 		ctDigest := FileDigest(ctName)
-		if !bytes.Equal(ctDigest, content[HashLen:2*HashLen]) {
+		if !bytes.Equal(ctDigest, block.CtDigest) {
+			return false
+		}
+		//check the algorithms, the chunk digests against their Merkle root, and the metadata
+		if !checkAlgorithms(block) || !ledger.checkChunks(i, block) || !ledger.checkMetadata(i, block) {
 			return false
 		}
-		//check hash of plaintext if it is the target block
+		//check digest of plaintext if it is the target block
 		if i == target {
-			if !bytes.Equal(ptDigest, content[2*HashLen:3*HashLen]) {
+			if !bytes.Equal(ptDigest, block.PtDigest) {
+				return false
+			}
+		}
+		//check control shard, or that the tombstone matches the block
+		record := ledger.GetKeyRecord(i)
+		if record == nil || !checkExpiry(record, block, epoch) {
+			return false
+		}
+		if IsTombstone(record) {
+			if !checkTombstone(record, block) {
+				return false
+			}
+		} else {
+			eps := ledger.controlShard(segments, i)
+			if eps == nil {
+				return false
+			}
+			keyEnc := Group.G1FromBytes(record)
+			if keyEnc == nil {
+				fmt.Println("Invalid encapsulated key", i)
+				return false
+			}
+			control := HashAte(eps, keyEnc)
+			if !bytes.Equal(control, block.Control) {
+				return false
+			}
+		}
+		//check that the author identity is registered
+		if author, ok := block.Fields[FieldAuthor]; ok {
+			if len(author) == 0 {
+				return false
+			}
+			if author[0] == AuthorIdentity && registry.Lookup(string(author[1:])) == nil {
 				return false
 			}
 		}
-		//check control shard
-		control := HashAte(&eps[i%int64(MaxShards)], ledger.GetEncKey(i))
-		if !bytes.Equal(control, content[3*HashLen:3*HashLen+PadSize]) {
+		//check the signature of the author, if present
+		if !block.CheckSignature(registry) {
 			return false
 		}
 	}
@@ -80,37 +234,81 @@ func (ledger Ledger) CheckConsistency(target int64, ptDigest []byte) bool {
 
 //DecryptBlock given an unlocked key decrypt corresponding file
 //index index of the block thar corresponds to the file
+//	for shared keys it is the index of the first part of the shared key
 //unlocked unlocked key for decryption
 //out path to file where to write decrypted file
+//compressed files are decompressed
 //the shards are taken from the ledger
 //correctly terminates only if the decryption is consistent with the static ledger
-func (ledger Ledger) DecryptBlock(index int64, unlocked *curve.ECP, out string) {
-	//get shards
-	eps := ledger.GetShards(MaxShards)
+//and the ledger matches the last checkpoint signed by the filekeeper
+//return the metadata of the file, nil if the block has none
+func (ledger Ledger) DecryptBlock(index int64, unlocked G1, out string) *Metadata {
+	//check shards and keys files before decrypting
+	if !ledger.VerifyCheckpoint(nil) {
+		panic("Ledger does not match the last checkpoint!")
+	}
+	block := ledger.GetBlock(index)
+	if block == nil {
+		panic("Missing block!")
+	}
+	//get only the shards that encrypted the file
+	ctName := ledger.EncryptPath + strconv.FormatInt(block.CiphertextIndex(index), 16) + ".enc"
+	eps := ledger.ShardRange(CountShards(ctName))
+	if eps == nil {
+		panic("Missing shards!")
+	}
 	//decrypt file
-	ctName := ledger.EncryptPath + strconv.FormatInt(index, 16) + ".enc"
 	EncryptFile(ctName, out, eps[:], unlocked)
-	//check integrity
-	ptDigest := FileDigest(out)
+	switch block.CompressionOf() {
+	case CompressNone:
+	case CompressFlate:
+		if !decompressFile(out) {
+			panic("Inconsistent decryption!")
+		}
+	default:
+		panic("Unknown compression!")
+	}
+	//check integrity of the original content
+	ptDigest := ledger.PlaintextDigest(index, unlocked, out)
 	if !ledger.CheckConsistency(index, ptDigest) {
 		panic("Inconsistent decryption!")
 	}
+	if _, ok := block.Fields[FieldMetadata]; !ok {
+		return nil
+	}
+	meta := ledger.GetMetadata(index, unlocked)
+	if meta == nil {
+		panic("Inconsistent metadata!")
+	}
+	return meta
 }
 
 //Init set up the updating ledger
 //given the paths in Ledger struct sets up the files:
 //generates empty root block,
+//writes the ledger parameters, starting from epoch 0 with MaxShards shards
+//and the algorithms and pairing group in use
 //generate the masking shards, save them on shardsFile
 //return secret time-key s
-func (ledger Ledger) Init() *curve.BIG {
+func (ledger Ledger) Init() Scalar {
 	//create empty root block
 	emptyFile, err := os.Create(ledger.RootPath + strconv.Itoa(0))
 	if err != nil {
 		panic(err)
 	}
 	emptyFile.Close()
-	//generate time-key
-	s := GenExp()
+	//write parameters
+	segments := []ShardSegment{{0, MaxShards}}
+	if !ledger.WriteParams(map[string]string{ParamEpoch: "0", ParamShards: encodeShardSegments(segments),
+		ParamHash: HashName, ParamXOF: XOFName, ParamGroup: Group.Name()}) {
+		panic("Error writing ledger parameters!")
+	}
+	//generate time-key and the exponents of the shards, in order
+	s := GenExpFrom(ledger.Rand)
+	exps := make([]Scalar, MaxShards)
+	for i := range exps {
+		exps[i] = GenExpFrom(ledger.Rand)
+	}
 	//channels for concurrent generation
 	shardChannel := make(chan shard, MaxShards)
 	done := make(chan bool)
@@ -119,11 +317,9 @@ func (ledger Ledger) Init() *curve.BIG {
 	for i := 0; i < MaxShards; i++ {
 		wg.Add(1)
 		go func(i int) {
-			temp := curve.G2mul(B2, GenExp())
-			temp = curve.G2mul(temp, s)
-			encoded := make([]byte, 2*curve.MODBYTES+1)
-			temp.ToBytes(encoded, true)
-			shardChannel <- shard{i, string(encoded)}
+			temp := Group.G2Generator().Mul(exps[i]).Mul(s)
+			exps[i].Wipe()
+			shardChannel <- shard{i, string(temp.Bytes())}
 			wg.Done()
 		}(i)
 	}
@@ -141,8 +337,9 @@ func (ledger Ledger) Init() *curve.BIG {
 //GetShards read masking shards from the ledger
 //file path taken from Ledger struct
 //numShards number of shards to read
-//return slice containing the masking shards read
-func (ledger Ledger) GetShards(numShards int) []curve.ECP2 {
+//return slice containing the masking shards read,
+//nil if the file is too short or contains an invalid shard
+func (ledger Ledger) GetShards(numShards int) []G2 {
 	//open shardsFile
 	file, err := os.Open(ledger.ShardsFile)
 	if err != nil {
@@ -157,9 +354,8 @@ func (ledger Ledger) GetShards(numShards int) []curve.ECP2 {
 	}()
 	//buffered reading
 	reader := bufio.NewReader(file)
-	size := 2*curve.MODBYTES + 1
-	buffer := make([]byte, size)
-	shards := make([]curve.ECP2, numShards)
+	buffer := make([]byte, Group.G2Len())
+	shards := make([]G2, numShards)
 	for i := 0; i < numShards; i++ {
 		_, err := io.ReadFull(reader, buffer)
 		if err != nil {
@@ -167,7 +363,10 @@ func (ledger Ledger) GetShards(numShards int) []curve.ECP2 {
 			return nil
 		}
 		//decode shard
-		shards[i] = *curve.ECP2_fromBytes(buffer)
+		if shards[i] = Group.G2FromBytes(buffer); shards[i] == nil {
+			fmt.Println("Invalid masking shard", i)
+			return nil
+		}
 	}
 	return shards
 }
@@ -175,19 +374,34 @@ func (ledger Ledger) GetShards(numShards int) []curve.ECP2 {
 //GetSingleShard read from file a single masking shard
 //index index of the masking shard to read
 //path to the file containing the masking shards taken from Ledger struct
-//return the masking shard
-func (ledger Ledger) GetSingleShard(index int64) *curve.ECP2 {
+//return the masking shard, nil if it cannot be read or is invalid
+func (ledger Ledger) GetSingleShard(index int64) G2 {
 	//read from file
-	encoded := ReadValue(ledger.ShardsFile, index, int64(2*curve.MODBYTES+1))
-	//decode key
-	return curve.ECP2_fromBytes(encoded)
+	encoded := ReadValue(ledger.ShardsFile, index, int64(Group.G2Len()))
+	if encoded == nil {
+		return nil
+	}
+	//decode shard
+	eps := Group.G2FromBytes(encoded)
+	if eps == nil {
+		fmt.Println("Invalid masking shard", index)
+	}
+	return eps
 }
 
 //AppendEncapsulatedKey append newest encapsulated key on key-file
 //keyEncFile output file path
 //encKey encapsulated key to append
 //returns the index of the written key
-func (ledger Ledger) AppendEncapsulatedKey(encKey *curve.ECP) int64 {
+func (ledger Ledger) AppendEncapsulatedKey(encKey G1) int64 {
+	return ledger.AppendEncapsulatedKeys([]G1{encKey})
+}
+
+//AppendEncapsulatedKeys append consecutive encapsulated keys on key-file
+//the keys are written with a single write
+//encKeys encapsulated keys to append
+//returns the index of the first written key
+func (ledger Ledger) AppendEncapsulatedKeys(encKeys []G1) int64 {
 	//open output file
 	file, err := os.OpenFile(ledger.KeysFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 	if err != nil {
@@ -205,11 +419,12 @@ func (ledger Ledger) AppendEncapsulatedKey(encKey *curve.ECP) int64 {
 		fmt.Println(err)
 		return -1
 	}
-	//write encapsulated key on file
-	size := curve.MODBYTES + 1
-	encoded := make([]byte, size)
-	//encode shard as compressed curve point
-	encKey.ToBytes(encoded, true)
+	//write encapsulated keys on file
+	size := Group.G1Len()
+	encoded := make([]byte, size*len(encKeys))
+	for i, encKey := range encKeys {
+		copy(encoded[i*size:], encKey.Bytes())
+	}
 	_, err = file.Write(encoded)
 	if err != nil {
 		fmt.Println(err)
@@ -219,51 +434,150 @@ func (ledger Ledger) AppendEncapsulatedKey(encKey *curve.ECP) int64 {
 	return fileinfo.Size() / int64(size)
 }
 
+//NumKeys compute the number of encapsulated keys (and therefore blocks)
+//path to the file containing the encapsulated keys taken from Ledger struct
+//return the number of keys, 0 if the key-file does not exist, -1 on failure
+func (ledger Ledger) NumKeys() int64 {
+	fi, err := os.Stat(ledger.KeysFile)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		fmt.Println(err)
+		return -1
+	}
+	return fi.Size() / int64(Group.G1Len())
+}
+
+//GetKeyRecord read from file the encoding of an encapsulated key
+//index index of the key to read
+//path to the file containing the encapsulated keys taken from Ledger struct
+//return the encoding of the key, or a tombstone
+func (ledger Ledger) GetKeyRecord(index int64) []byte {
+	return ReadValue(ledger.KeysFile, index, int64(Group.G1Len()))
+}
+
 //GetEncKey read from file the value of the encapsulated key
 //index index of the key to read
 //path to the file containing the encapsulated keys taken from Ledger struct
-//return the encapsulated key
-func (ledger Ledger) GetEncKey(index int64) *curve.ECP {
+//return the encapsulated key, nil if the key has been replaced by a tombstone,
+//cannot be read or is invalid
+func (ledger Ledger) GetEncKey(index int64) G1 {
 	//read from file
-	encoded := ReadValue(ledger.KeysFile, index, int64(curve.MODBYTES+1))
+	encoded := ledger.GetKeyRecord(index)
+	if encoded == nil {
+		return nil
+	}
+	if IsTombstone(encoded) {
+		fmt.Println("Encapsulated key", index, "has been removed")
+		return nil
+	}
 	//decode key
-	return curve.ECP_fromBytes(encoded)
+	keyEnc := Group.G1FromBytes(encoded)
+	if keyEnc == nil {
+		fmt.Println("Invalid encapsulated key", index)
+	}
+	return keyEnc
+}
+
+//validKeys check that every record of the key-file is a valid encapsulated key
+//or a tombstone
+//numKey number of encapsulated keys (and therefore blocks) present
+//return true if every record is valid
+func (ledger Ledger) validKeys(numKey int) bool {
+	size := Group.G1Len()
+	if numKey == 0 {
+		return true
+	}
+	content := ReadValue(ledger.KeysFile, 0, int64(numKey*size))
+	if content == nil {
+		return false
+	}
+	for i := 0; i < numKey; i++ {
+		record := content[i*size : (i+1)*size]
+		if !IsTombstone(record) && Group.G1FromBytes(record) == nil {
+			fmt.Println("Invalid encapsulated key", i)
+			return false
+		}
+	}
+	return true
 }
 
 //Update update shards and keys, and generate new time-key
 //keyEncFile file containing encapsulated keys
 //shardsFile file containing masking shards
+//the keys of blocks expiring in the new epoch are replaced by tombstones
+//the update is done holding the writer lock of the ledger
 //s current time-key
 //return new time-key
-func (ledger Ledger) Update(s *curve.BIG) *curve.BIG {
-	//generate time-key
-	sNew := GenExp()
-	//process shard file concurrently
-	shardUpd := func(inp shard) shard {
-		old := curve.ECP2_fromBytes([]byte(inp.value))
-		return shardUpdate(inp.index, old, s, sNew)
+func (ledger Ledger) Update(s Scalar) Scalar {
+	unlock := ledger.Lock()
+	if unlock == nil {
+		return nil
 	}
-	ProcessFile(ledger.ShardsFile, ledger.ShardsFile, shardUpd, MaxShards, int(2*curve.MODBYTES+1))
-	//process encapsulated key file cuncurrently
+	defer unlock()
+	return ledger.update(s, ledger.Rand)
+}
+
+//update update shards and keys without taking the writer lock
+//s current time-key
+//rng source of randomness of the new time-key, nil to use crypto/rand
+//return new time-key
+func (ledger Ledger) update(s Scalar, rng io.Reader) Scalar {
+	//compute new epoch
+	epoch := ledger.Epoch()
+	if epoch < 0 {
+		return nil
+	}
+	epoch++
 	//compute file size to determine concurrency
+	//no key-file if no block has been added yet
+	sizeKey := Group.G1Len()
+	numKey := 0
 	fi, err := os.Stat(ledger.KeysFile)
-	if err != nil {
+	if err == nil {
+		//compute number of keys
+		numKey = int(fi.Size()) / sizeKey
+	} else if !os.IsNotExist(err) {
 		fmt.Println(err)
 		return nil
 	}
-	//compute number of keys
-	sizeKey := int(curve.MODBYTES + 1)
-	numKey := int(fi.Size()) / sizeKey
+	//read expiry of the blocks and validate shards and keys before changing any file
+	//the number of shards is read from the ledger, it changes with ExtendShards
+	expiries := ledger.expiries(numKey)
+	numShards := ledger.NumShards()
+	if expiries == nil || numShards < 0 || ledger.GetShards(numShards) == nil || !ledger.validKeys(numKey) {
+		return nil
+	}
+	//generate time-key
+	sNew := GenExpFrom(rng)
+	//process shard file concurrently
+	shardUpd := func(inp shard) shard {
+		old := Group.G2FromBytes([]byte(inp.value))
+		return shardUpdate(inp.index, old, s, sNew)
+	}
+	ProcessFile(ledger.ShardsFile, ledger.ShardsFile, shardUpd, numShards, Group.G2Len())
+	//process encapsulated key file cuncurrently
 	updKey := func(inp shard) shard {
+		//tombstones are not updated anymore
+		if IsTombstone([]byte(inp.value)) {
+			return inp
+		}
+		//expired keys are not carried forward
+		if expiry, ok := expiries[inp.index]; ok && expiry <= epoch {
+			return shard{inp.index, string(expiredTombstone(epoch))}
+		}
 		//import old key
-		old := curve.ECP_fromBytes([]byte(inp.value))
+		old := Group.G1FromBytes([]byte(inp.value))
 		//update key
 		new := FracMult(old, sNew, s)
-		//encode key
-		encoded := make([]byte, sizeKey)
-		new.ToBytes(encoded, true)
-		return shard{inp.index, string(encoded)}
+		return shard{inp.index, string(new.Bytes())}
+	}
+	if numKey > 0 {
+		ProcessFile(ledger.KeysFile, ledger.KeysFile, updKey, numKey, sizeKey)
+	}
+	if !ledger.SetParam(ParamEpoch, strconv.FormatInt(epoch, 10)) {
+		return nil
 	}
-	ProcessFile(ledger.KeysFile, ledger.KeysFile, updKey, numKey, sizeKey)
 	return sNew
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckConsistencyTarget(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	u := GenUser()
+	token := fk.TokenGen(u.PublicKey)
+	u.AddBlock(ledger, token, newTestFile(t, 100))
+	index := u.AddBlock(ledger, token, newTestFile(t, 100))
+	digest := ledger.GetBlock(index).PtDigest
+	//the target block is checked too, also when it is the last one
+	if !ledger.CheckConsistency(index, digest) {
+		t.Fatal("consistent block rejected")
+	}
+	if ledger.CheckConsistency(index, make([]byte, len(digest))) {
+		t.Fatal("plaintext digest of the target block not checked")
+	}
+}
+
+func TestLedgerWithoutParams(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	//ledgers created before the parameters file
+	if err := os.Remove(ledger.ParamsFile); err != nil {
+		t.Fatal(err)
+	}
+	if ledger.Epoch() != 0 || ledger.NumShards() != 16 {
+		t.Fatal("missing parameters not defaulted")
+	}
+	u := GenUser()
+	if u.AddBlock(ledger, fk.TokenGen(u.PublicKey), newTestFile(t, 300)) < 0 {
+		t.Fatal("block not added")
+	}
+	if !ledger.CheckConsistency(-1, nil) || fk.Update() == nil || ledger.Epoch() != 1 {
+		t.Fatal("ledger without parameters not usable")
+	}
+}
+
+func TestUpdateAuditFailure(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	if !fk.SetSigner(GenSigningKey()) {
+		t.Fatal("signing key not set")
+	}
+	//the audit log cannot be written anymore
+	fk.Ledger.AuditFile = t.TempDir()
+	if fk.Update() != nil {
+		t.Fatal("update not recorded in the audit log reported as successful")
+	}
+	if ledger.Epoch() != 1 {
+		t.Fatal("ledger not updated")
+	}
+}
+
+func TestUpdateExtendedShards(t *testing.T) {
+	ledger, fk := newTestLedger(t, 4)
+	if !fk.ExtendShards(4) || MaxShards != 4 || ledger.NumShards() != 8 {
+		t.Fatal("shards not extended on the ledger only")
+	}
+	//a file needing the new shards is decrypted after the update
+	u := GenUser()
+	fileName := newTestFile(t, 700)
+	index := u.AddBlock(ledger, fk.TokenGen(u.PublicKey), fileName)
+	if index < 0 || fk.Update() == nil {
+		t.Fatal("block not added")
+	}
+	out := filepath.Join(t.TempDir(), "decrypted")
+	unlocked := u.UnlockKey(ledger.GetEncKey(index))
+	ledger.DecryptBlock(index, unlocked, out)
+	if !bytes.Equal(ledger.PlaintextDigest(index, unlocked, out), ledger.GetBlock(index).PtDigest) {
+		t.Fatal("block not decrypted after the update")
+	}
+}
+
+func TestSetParamReadFailure(t *testing.T) {
+	ledger, _ := newTestLedger(t, 16)
+	params := ledger.ReadParams()
+	//a parameters file that cannot be read is not replaced
+	unreadable := ledger
+	unreadable.ParamsFile = t.TempDir()
+	if unreadable.SetParam(ParamEpoch, "5") {
+		t.Fatal("parameter written without the other parameters")
+	}
+	if !ledger.SetParam(ParamEpoch, "5") || ledger.Epoch() != 5 {
+		t.Fatal("parameter not written")
+	}
+	for name, value := range params {
+		if name != ParamEpoch && ledger.ReadParams()[name] != value {
+			t.Fatal("parameter", name, "lost")
+		}
+	}
+	//no temporary file is left next to the parameters
+	matches, err := filepath.Glob(ledger.ParamsFile + ".tmp*")
+	if err != nil || len(matches) > 0 {
+		t.Fatal("temporary files left:", matches)
+	}
+}
+
+func TestUpdateMissingBlock(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	u := GenUser()
+	index := u.AddBlock(ledger, fk.TokenGen(u.PublicKey), newTestFile(t, 100))
+	if index < 0 {
+		t.Fatal("block not added")
+	}
+	//the key of a deleted block is not kept alive
+	if err := os.Remove(ledger.BlockName(index)); err != nil {
+		t.Fatal(err)
+	}
+	if fk.Update() != nil || ledger.Epoch() != 0 {
+		t.Fatal("ledger updated with a missing block")
+	}
+}
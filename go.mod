@@ -1,6 +1,6 @@
 module github.com/gaetanorusso/public_ledger_sensitive_data
 
-go 1.14
+go 1.18
 
 require (
   github.com/miracl/core v0.0.0-20200621154713-0c423b062913
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	curve "github.com/gaetanorusso/public_ledger_sensitive_data/miracl/go/core/BN254"
+)
+
+//ParamGroup name of the ledger parameter with the pairing group, see PairingGroups
+const ParamGroup = "group"
+
+//Scalar element of the scalar field of a pairing group
+//operations return new elements and leave their operands unchanged
+type Scalar interface {
+	//Bytes encode the scalar in ScalarLen bytes
+	Bytes() []byte
+	//Add return the sum modulo the group order
+	Add(Scalar) Scalar
+	//Mul return the product modulo the group order
+	Mul(Scalar) Scalar
+	//Inverse return the inverse modulo the group order
+	Inverse() Scalar
+	//Wipe overwrite the scalar with zero, see Wipe
+	Wipe()
+}
+
+//G1 element of the first source group of a pairing group
+type G1 interface {
+	//Bytes encode the element in G1Len bytes
+	//the first byte of an encoding is 0x02 or 0x03, see IsTombstone
+	Bytes() []byte
+	Equals(G1) bool
+	IsIdentity() bool
+	Add(G1) G1
+	Sub(G1) G1
+	Mul(Scalar) G1
+	//Wipe overwrite the element with the identity, for unlocked keys
+	Wipe()
+}
+
+//G2 element of the second source group of a pairing group
+type G2 interface {
+	//Bytes encode the element in G2Len bytes
+	Bytes() []byte
+	Equals(G2) bool
+	IsIdentity() bool
+	Mul(Scalar) G2
+}
+
+//GT element of the target group of a pairing group
+type GT interface {
+	//Bytes encode the element, input of the pad derivation
+	Bytes() []byte
+	//Wipe overwrite the element, it is as secret as the pad
+	Wipe()
+}
+
+//PairingGroup bilinear group the protocol is built on
+//keys are elements of G1, masking shards of G2, pads are derived from GT
+type PairingGroup interface {
+	Name() string
+	//ScalarLen, G1Len, G2Len lengths of the encodings in bytes
+	ScalarLen() int
+	G1Len() int
+	G2Len() int
+	//RandomScalar generate a scalar uniform in [2..order-1]
+	RandomScalar(io.Reader) Scalar
+	//ScalarFromBytes decode a big endian integer reduced modulo the group order
+	ScalarFromBytes([]byte) Scalar
+	G1Generator() G1
+	G2Generator() G2
+	//G1FromBytes, G2FromBytes decode an element of G1, G2
+	//return nil if the encoding is not the canonical encoding of an element
+	//of the group, or encodes the identity
+	G1FromBytes([]byte) G1
+	G2FromBytes([]byte) G2
+	//Pair compute the pairing of a G2 and a G1 element
+	Pair(G2, G1) GT
+}
+
+//Group pairing group in use
+var Group PairingGroup = BN254{}
+
+//PairingGroups pairing groups that can be used by a ledger
+var PairingGroups = []PairingGroup{BN254{}}
+
+//SetGroup choose the pairing group in use
+//modifies global variable Group
+//name name of the pairing group
+//return true if the group is known
+func SetGroup(name string) bool {
+	for _, group := range PairingGroups {
+		if group.Name() == name {
+			Group = group
+			return true
+		}
+	}
+	fmt.Println("Unknown pairing group:", name)
+	return false
+}
+
+//LoadGroup choose the pairing group recorded in the ledger parameters
+//ledgers without the parameter use BN254
+//the parameters file path is taken from Ledger struct
+//return true if the recorded group is known
+func (ledger Ledger) LoadGroup() bool {
+	params := ledger.ReadParams()
+	if params == nil {
+		return false
+	}
+	name := params[ParamGroup]
+	if name == "" {
+		name = BN254{}.Name()
+	}
+	return SetGroup(name)
+}
+
+//BN254 pairing group of the BN254 curve, with the optimal Ate pairing
+type BN254 struct{}
+
+//ORDER order of curve
+var ORDER *curve.BIG = curve.NewBIGints(curve.CURVE_Order)
+
+type bn254Scalar struct{ big *curve.BIG }
+type bn254G1 struct{ point *curve.ECP }
+type bn254G2 struct{ point *curve.ECP2 }
+type bn254GT struct{ gt *curve.FP12 }
+
+//Name name of the group in the ledger parameters
+func (BN254) Name() string { return "bn254" }
+
+//ScalarLen length of the encoding of a scalar
+func (BN254) ScalarLen() int { return int(curve.MODBYTES) }
+
+//G1Len length of the compressed encoding of a G1 element
+func (BN254) G1Len() int { return int(curve.MODBYTES) + 1 }
+
+//G2Len length of the compressed encoding of a G2 element
+func (BN254) G2Len() int { return 2*int(curve.MODBYTES) + 1 }
+
+//RandomScalar generate cryptographically secure random exponent
+//result uniform in [2..ORDER-1]
+func (BN254) RandomScalar(rng io.Reader) Scalar {
+	entropy := make([]byte, curve.MODBYTES)
+	r := curve.NewBIGint(0)
+	//continue generating until the value is in [2..ORDER-1]
+	for curve.Comp(r, curve.NewBIGint(1)) <= 0 {
+		_, err := io.ReadFull(rng, entropy)
+		if err != nil {
+			fmt.Println("Error generating random exponent:", err)
+			panic(err)
+		}
+		r = curve.FromBytes(entropy)
+		r.Mod(ORDER)
+	}
+	return bn254Scalar{r}
+}
+
+//ScalarFromBytes decode a scalar reduced modulo ORDER
+func (BN254) ScalarFromBytes(encoded []byte) Scalar {
+	padded := make([]byte, curve.MODBYTES)
+	if len(encoded) > len(padded) {
+		encoded = encoded[:len(padded)]
+	}
+	copy(padded[len(padded)-len(encoded):], encoded)
+	r := curve.FromBytes(padded)
+	r.Mod(ORDER)
+	return bn254Scalar{r}
+}
+
+//G1Generator generator of G1
+func (BN254) G1Generator() G1 { return bn254G1{curve.ECP_generator()} }
+
+//G2Generator generator of G2
+func (BN254) G2Generator() G2 { return bn254G2{curve.ECP2_generator()} }
+
+//compressedPoint check the length and the prefix of a compressed point
+//before decoding it, the decoders of the curve do not check them
+func compressedPoint(encoded []byte, size int) bool {
+	return len(encoded) == size && (encoded[0] == 0x02 || encoded[0] == 0x03)
+}
+
+//G1FromBytes decode a G1 element
+//points not on the curve decode to the point at infinity, and every point
+//of the curve is in G1 (cofactor 1)
+//return nil if the encoding is not valid
+func (group BN254) G1FromBytes(encoded []byte) G1 {
+	if !compressedPoint(encoded, group.G1Len()) {
+		return nil
+	}
+	p := bn254G1{curve.ECP_fromBytes(encoded)}
+	if p.IsIdentity() || !bytes.Equal(p.Bytes(), encoded) {
+		return nil
+	}
+	return p
+}
+
+//G2FromBytes decode a G2 element
+//the point must be on the twist and in the subgroup of order ORDER
+//return nil if the encoding is not valid
+func (group BN254) G2FromBytes(encoded []byte) G2 {
+	if !compressedPoint(encoded, group.G2Len()) {
+		return nil
+	}
+	p := bn254G2{curve.ECP2_fromBytes(encoded)}
+	if !curve.G2member(p.point) || !bytes.Equal(p.Bytes(), encoded) {
+		return nil
+	}
+	return p
+}
+
+//Pair compute the Ate-pairing
+func (BN254) Pair(eps G2, key G1) GT {
+	//NB: to compute the pairing correctly the final exp has to be done explicitly
+	gt := curve.Ate(eps.(bn254G2).point, key.(bn254G1).point)
+	return bn254GT{curve.Fexp(gt)}
+}
+
+func (s bn254Scalar) Bytes() []byte {
+	encoded := make([]byte, curve.MODBYTES)
+	s.big.ToBytes(encoded)
+	return encoded
+}
+
+func (s bn254Scalar) Add(t Scalar) Scalar {
+	return bn254Scalar{curve.Modadd(s.big, t.(bn254Scalar).big, ORDER)}
+}
+
+func (s bn254Scalar) Mul(t Scalar) Scalar {
+	return bn254Scalar{curve.Modmul(s.big, t.(bn254Scalar).big, ORDER)}
+}
+
+func (s bn254Scalar) Inverse() Scalar {
+	inv := curve.NewBIGcopy(s.big)
+	inv.Invmodp(ORDER)
+	return bn254Scalar{inv}
+}
+
+//Wipe reduce the scalar modulo 1, the BIG type has no exported zeroing
+func (s bn254Scalar) Wipe() { s.big.Mod(curve.NewBIGint(1)) }
+
+func (p bn254G1) Bytes() []byte {
+	encoded := make([]byte, curve.MODBYTES+1)
+	p.point.ToBytes(encoded, true)
+	return encoded
+}
+
+func (p bn254G1) Equals(q G1) bool { return p.point.Equals(q.(bn254G1).point) }
+
+func (p bn254G1) IsIdentity() bool { return p.point.Is_infinity() }
+
+func (p bn254G1) Add(q G1) G1 {
+	sum := curve.NewECP()
+	sum.Copy(p.point)
+	sum.Add(q.(bn254G1).point)
+	return bn254G1{sum}
+}
+
+func (p bn254G1) Sub(q G1) G1 {
+	diff := curve.NewECP()
+	diff.Copy(p.point)
+	diff.Sub(q.(bn254G1).point)
+	return bn254G1{diff}
+}
+
+func (p bn254G1) Mul(s Scalar) G1 { return bn254G1{curve.G1mul(p.point, s.(bn254Scalar).big)} }
+
+func (p bn254G1) Wipe() { p.point.Copy(curve.NewECP()) }
+
+func (p bn254G2) Bytes() []byte {
+	encoded := make([]byte, 2*curve.MODBYTES+1)
+	p.point.ToBytes(encoded, true)
+	return encoded
+}
+
+func (p bn254G2) Equals(q G2) bool { return p.point.Equals(q.(bn254G2).point) }
+
+func (p bn254G2) IsIdentity() bool { return p.point.Is_infinity() }
+
+func (p bn254G2) Mul(s Scalar) G2 { return bn254G2{curve.G2mul(p.point, s.(bn254Scalar).big)} }
+
+func (g bn254GT) Bytes() []byte {
+	encoded := make([]byte, 12*curve.MODBYTES)
+	g.gt.ToBytes(encoded)
+	return encoded
+}
+
+func (g bn254GT) Wipe() { g.gt.Copy(curve.NewFP12int(0)) }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"math/bits"
+	"testing"
+)
+
+//testOrder order of the test group, the Mersenne prime 2^61-1
+const testOrder = 1<<61 - 1
+
+//testGroup deliberately insecure pairing group for fast tests of the protocol
+//G1, G2 and GT are the integers modulo testOrder under addition, and the
+//pairing is their product: discrete logarithms are trivial, never use it
+//for real data
+type testGroup struct{}
+
+//elements are pointers so that they can be wiped in place
+type testScalar struct{ v uint64 }
+type testG1 struct{ v uint64 }
+type testG2 struct{ v uint64 }
+type testGT struct{ v uint64 }
+
+func init() {
+	PairingGroups = append(PairingGroups, testGroup{})
+}
+
+//testMul multiply modulo testOrder
+func testMul(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return bits.Rem64(hi, lo, testOrder)
+}
+
+//testAdd add modulo testOrder
+func testAdd(a, b uint64) uint64 {
+	return (a + b) % testOrder
+}
+
+//testEncode encode an element with the prefix of compressed points
+func testEncode(value uint64) []byte {
+	encoded := make([]byte, 9)
+	encoded[0] = 0x02
+	binary.BigEndian.PutUint64(encoded[1:], value)
+	return encoded
+}
+
+//testDecode decode an element
+//return false if the encoding is malformed, not reduced or the identity
+func testDecode(encoded []byte) (uint64, bool) {
+	if len(encoded) != 9 || encoded[0] != 0x02 {
+		return 0, false
+	}
+	value := binary.BigEndian.Uint64(encoded[1:])
+	return value, value != 0 && value < testOrder
+}
+
+func (testGroup) Name() string   { return "insecure-test" }
+func (testGroup) ScalarLen() int { return 8 }
+func (testGroup) G1Len() int     { return 9 }
+func (testGroup) G2Len() int     { return 9 }
+
+func (testGroup) RandomScalar(rng io.Reader) Scalar {
+	entropy := make([]byte, 8)
+	var r uint64
+	for r < 2 {
+		if _, err := io.ReadFull(rng, entropy); err != nil {
+			panic(err)
+		}
+		r = binary.BigEndian.Uint64(entropy) % testOrder
+	}
+	return &testScalar{r}
+}
+
+func (testGroup) ScalarFromBytes(encoded []byte) Scalar {
+	r := new(big.Int).SetBytes(encoded)
+	return &testScalar{r.Mod(r, big.NewInt(testOrder)).Uint64()}
+}
+
+func (testGroup) G1Generator() G1 { return &testG1{1} }
+func (testGroup) G2Generator() G2 { return &testG2{1} }
+
+func (testGroup) G1FromBytes(encoded []byte) G1 {
+	if value, ok := testDecode(encoded); ok {
+		return &testG1{value}
+	}
+	return nil
+}
+
+func (testGroup) G2FromBytes(encoded []byte) G2 {
+	if value, ok := testDecode(encoded); ok {
+		return &testG2{value}
+	}
+	return nil
+}
+
+func (testGroup) Pair(eps G2, key G1) GT {
+	return &testGT{testMul(eps.(*testG2).v, key.(*testG1).v)}
+}
+
+func (s *testScalar) Bytes() []byte {
+	encoded := make([]byte, 8)
+	binary.BigEndian.PutUint64(encoded, s.v)
+	return encoded
+}
+
+func (s *testScalar) Add(t Scalar) Scalar { return &testScalar{testAdd(s.v, t.(*testScalar).v)} }
+func (s *testScalar) Mul(t Scalar) Scalar { return &testScalar{testMul(s.v, t.(*testScalar).v)} }
+func (s *testScalar) Wipe()               { s.v = 0 }
+
+func (s *testScalar) Inverse() Scalar {
+	//Fermat: s^(order-2)
+	inv, base := uint64(1), s.v
+	for e := uint64(testOrder - 2); e > 0; e >>= 1 {
+		if e&1 == 1 {
+			inv = testMul(inv, base)
+		}
+		base = testMul(base, base)
+	}
+	return &testScalar{inv}
+}
+
+func (p *testG1) Bytes() []byte    { return testEncode(p.v) }
+func (p *testG1) Equals(q G1) bool { return p.v == q.(*testG1).v }
+func (p *testG1) IsIdentity() bool { return p.v == 0 }
+func (p *testG1) Add(q G1) G1      { return &testG1{testAdd(p.v, q.(*testG1).v)} }
+func (p *testG1) Sub(q G1) G1      { return &testG1{testAdd(p.v, testOrder-q.(*testG1).v)} }
+func (p *testG1) Mul(s Scalar) G1  { return &testG1{testMul(p.v, s.(*testScalar).v)} }
+func (p *testG1) Wipe()            { p.v = 0 }
+func (p *testG2) Bytes() []byte    { return testEncode(p.v) }
+func (p *testG2) Equals(q G2) bool { return p.v == q.(*testG2).v }
+func (p *testG2) IsIdentity() bool { return p.v == 0 }
+func (p *testG2) Mul(s Scalar) G2  { return &testG2{testMul(p.v, s.(*testScalar).v)} }
+func (g *testGT) Bytes() []byte    { return (&testScalar{g.v}).Bytes() }
+func (g *testGT) Wipe()            { g.v = 0 }
+
+//testGroupProperties check encodings and bilinearity of a pairing group
+func testGroupProperties(t *testing.T, group PairingGroup) {
+	a, b := group.RandomScalar(rand.Reader), group.RandomScalar(rand.Reader)
+	P, Q := group.G1Generator().Mul(a), group.G2Generator().Mul(b)
+	if len(a.Bytes()) != group.ScalarLen() || len(P.Bytes()) != group.G1Len() || len(Q.Bytes()) != group.G2Len() {
+		t.Fatal("wrong encoding length")
+	}
+	if P.Bytes()[0] != 0x02 && P.Bytes()[0] != 0x03 {
+		t.Fatal("G1 encoding would be a tombstone")
+	}
+	if !group.G1FromBytes(P.Bytes()).Equals(P) || !group.G2FromBytes(Q.Bytes()).Equals(Q) {
+		t.Fatal("decoding does not invert encoding")
+	}
+	if string(group.ScalarFromBytes(a.Bytes()).Mul(a.Inverse()).Mul(b).Bytes()) != string(b.Bytes()) {
+		t.Fatal("scalar decoding or inverse wrong")
+	}
+	if !P.Add(P).Sub(P).Equals(P) || P.IsIdentity() || !P.Sub(P).IsIdentity() {
+		t.Fatal("G1 addition wrong")
+	}
+	//wiped secrets are zero
+	c, R := group.RandomScalar(rand.Reader), group.G1Generator().Mul(b)
+	c.Wipe()
+	R.Wipe()
+	if string(c.Bytes()) != string(make([]byte, group.ScalarLen())) || !R.IsIdentity() {
+		t.Fatal("wipe did not clear the secret")
+	}
+	//e(b*Q, a*P) = e(Q, ab*P) = e(ab*Q, P)
+	left := group.Pair(Q.Mul(b), P.Mul(a)).Bytes()
+	middle := group.Pair(Q, P.Mul(a.Mul(b))).Bytes()
+	right := group.Pair(Q.Mul(a.Mul(b)), P).Bytes()
+	if string(left) != string(middle) || string(middle) != string(right) {
+		t.Fatal("pairing not bilinear")
+	}
+}
+
+func TestPairingGroups(t *testing.T) {
+	for _, group := range PairingGroups {
+		t.Run(group.Name(), func(t *testing.T) {
+			testGroupProperties(t, group)
+		})
+	}
+}
+
+func TestGroupRecordedInParams(t *testing.T) {
+	ledger, _ := newTestLedger(t, 4)
+	Group = BN254{}
+	if !ledger.LoadGroup() || Group.Name() != (testGroup{}).Name() {
+		t.Fatal("pairing group not restored from the ledger parameters")
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+//KeystoreVersion version of the keystore file format
+const KeystoreVersion byte = 1
+
+//KeystoreExt extension of the keystore files
+const KeystoreExt = ".key"
+
+//scrypt parameters used to derive the keystore encryption key
+const (
+	scryptN  = 1 << 15
+	scryptR  = 8
+	scryptP  = 1
+	saltLen  = 16
+	nonceLen = 12
+)
+
+//keystoreHeaderLen byte size of the keystore header after the magic:
+//version, salt, nonce and public key in the pairing group in use
+func keystoreHeaderLen() int {
+	return 1 + saltLen + nonceLen + Group.G1Len()
+}
+
+//secretsLen byte size of the secrets before the list of owned blocks:
+//mu, v and number of owned blocks
+func secretsLen() int {
+	return 2*Group.ScalarLen() + 8
+}
+
+//keystoreMagic identifies keystore files
+var keystoreMagic = []byte("PLSDKEY")
+
+//Keystore struct that contains the path of the folder with the keystore files
+type Keystore struct {
+	Path string
+}
+
+//Export encrypt the user secrets and save them on file
+//the file contains in clear only the public key
+//the private keys and the list of owned blocks are encrypted with AES-GCM
+//under a key derived from the passphrase with scrypt
+//path output file path
+//passphrase passphrase protecting the keystore file
+//return true if the file was written successfully
+func (u User) Export(path, passphrase string) bool {
+	//header: magic, version, random salt and nonce, public key
+	header := make([]byte, len(keystoreMagic)+keystoreHeaderLen())
+	copy(header, keystoreMagic)
+	fields := header[len(keystoreMagic):]
+	fields[0] = KeystoreVersion
+	salt := fields[1 : 1+saltLen]
+	nonce := fields[1+saltLen : 1+saltLen+nonceLen]
+	if _, err := rand.Read(fields[1 : 1+saltLen+nonceLen]); err != nil {
+		fmt.Println("Error generating keystore salt:", err)
+		return false
+	}
+	//public key in clear, authenticated as additional data
+	copy(fields[1+saltLen+nonceLen:], u.PublicKey.Bytes())
+	//serialize secrets: mu, v, number of blocks, block indices
+	scalarLen, secLen := Group.ScalarLen(), secretsLen()
+	plain := make([]byte, secLen+8*len(u.Blocks))
+	copy(plain[:scalarLen], u.mu.Bytes())
+	copy(plain[scalarLen:2*scalarLen], u.v.Bytes())
+	binary.BigEndian.PutUint64(plain[2*scalarLen:], uint64(len(u.Blocks)))
+	for i, index := range u.Blocks {
+		binary.BigEndian.PutUint64(plain[secLen+8*i:], uint64(index))
+	}
+	//encrypt
+	aead := keystoreCipher(passphrase, salt)
+	if aead == nil {
+		return false
+	}
+	content := aead.Seal(header, nonce, plain, header)
+	Wipe(plain)
+	//write file readable only by the owner, replacing the previous one
+	//atomically so that a crash never loses the identity
+	return replaceFile(path, content, 0600)
+}
+
+//ImportUser read and decrypt a keystore file
+//path keystore file path
+//passphrase passphrase protecting the keystore file
+//return the user stored in the keystore, nil if the file is corrupted
+//or the passphrase is wrong
+func ImportUser(path, passphrase string) *User {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Println("File reading error", err)
+		return nil
+	}
+	pk := readKeystoreHeader(content)
+	if pk == nil {
+		return nil
+	}
+	headerLen := keystoreHeaderLen()
+	header := content[len(keystoreMagic) : len(keystoreMagic)+headerLen]
+	salt := header[1 : 1+saltLen]
+	nonce := header[1+saltLen : 1+saltLen+nonceLen]
+	//decrypt secrets
+	aead := keystoreCipher(passphrase, salt)
+	if aead == nil {
+		return nil
+	}
+	plain, err := aead.Open(nil, nonce, content[len(keystoreMagic)+headerLen:], content[:len(keystoreMagic)+headerLen])
+	if err != nil {
+		fmt.Println("Error decrypting keystore: wrong passphrase or corrupted file")
+		return nil
+	}
+	defer Wipe(plain)
+	scalarLen, secLen := Group.ScalarLen(), secretsLen()
+	if len(plain) < secLen {
+		fmt.Println("Error decrypting keystore: incomplete secrets!")
+		return nil
+	}
+	mu := Group.ScalarFromBytes(plain[:scalarLen])
+	v := Group.ScalarFromBytes(plain[scalarLen : 2*scalarLen])
+	//check that the secrets match the public key
+	if !Group.G1Generator().Mul(mu).Equals(pk) {
+		fmt.Println("Error decrypting keystore: secrets do not match public key")
+		WipeScalars(mu, v)
+		return nil
+	}
+	//read owned blocks, the count is bounded by the remaining payload
+	//before sizing the list
+	num := binary.BigEndian.Uint64(plain[2*scalarLen:])
+	if num > uint64(len(plain)-secLen)/8 || uint64(len(plain)) != uint64(secLen)+8*num {
+		fmt.Println("Error decrypting keystore: incomplete block list!")
+		WipeScalars(mu, v)
+		return nil
+	}
+	blocks := make([]int64, num)
+	for i := range blocks {
+		blocks[i] = int64(binary.BigEndian.Uint64(plain[secLen+8*i:]))
+	}
+	return &User{PublicKey: pk, mu: mu, v: v, Blocks: blocks}
+}
+
+//keystoreCipher derive the AES-GCM cipher from the passphrase
+//passphrase passphrase protecting the keystore file
+//salt random salt stored in the keystore header
+//return the authenticated cipher
+func keystoreCipher(passphrase string, salt []byte) cipher.AEAD {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		fmt.Println("Error deriving keystore key:", err)
+		return nil
+	}
+	defer Wipe(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return aead
+}
+
+//readKeystoreHeader check the header of a keystore file
+//content content of the keystore file
+//return the public key stored in clear, nil if the header is not valid
+func readKeystoreHeader(content []byte) G1 {
+	headerLen := keystoreHeaderLen()
+	if len(content) < len(keystoreMagic)+headerLen || !bytes.Equal(content[:len(keystoreMagic)], keystoreMagic) {
+		fmt.Println("Error reading keystore: not a keystore file")
+		return nil
+	}
+	header := content[len(keystoreMagic) : len(keystoreMagic)+headerLen]
+	if header[0] != KeystoreVersion {
+		fmt.Println("Error reading keystore: unsupported version", header[0])
+		return nil
+	}
+	pubKey := Group.G1FromBytes(header[1+saltLen+nonceLen:])
+	if pubKey == nil {
+		fmt.Println("Error reading keystore: invalid public key")
+	}
+	return pubKey
+}
+
+//KeyPath compute the path of the keystore file of an identity
+//name name of the identity
+//return the path of the keystore file
+func (ks Keystore) KeyPath(name string) string {
+	return filepath.Join(ks.Path, name+KeystoreExt)
+}
+
+//newKeyPath prepare the keystore for a new identity
+//name name of the new identity
+//return the path of the keystore file, empty if the name is not valid,
+//the identity already exists or the keystore folder cannot be created
+func (ks Keystore) newKeyPath(name string) string {
+	if name == "" || strings.ContainsRune(name, filepath.Separator) {
+		fmt.Println("Invalid identity name:", name)
+		return ""
+	}
+	if err := os.MkdirAll(ks.Path, 0700); err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	path := ks.KeyPath(name)
+	if _, err := os.Stat(path); err == nil {
+		fmt.Println("Identity already exists:", name)
+		return ""
+	}
+	return path
+}
+
+//Create generate a new user and save it in the keystore
+//name name of the new identity
+//passphrase passphrase protecting the keystore file
+//return the new user, nil if the identity already exists or cannot be saved
+func (ks Keystore) Create(name, passphrase string) *User {
+	path := ks.newKeyPath(name)
+	if path == "" {
+		return nil
+	}
+	u := GenUser()
+	if !u.Export(path, passphrase) {
+		return nil
+	}
+	return u
+}
+
+//FileKeeperIdentity name of the keystore identity holding the signing key
+//of the filekeeper
+const FileKeeperIdentity = "filekeeper"
+
+//FileKeeperSigner load the signing key of the filekeeper from the keystore
+//the key is derived from the secrets of the identity FileKeeperIdentity,
+//created on first use, so that the audit log is signed with the same key
+//across runs and whatever the hash function of the ledger, see User.SigningKey
+//passphrase passphrase protecting the keystore file
+//return the signing key, nil if the identity cannot be created or decrypted
+func (ks Keystore) FileKeeperSigner(passphrase string) *SigningKey {
+	var u *User
+	if _, err := os.Stat(ks.KeyPath(FileKeeperIdentity)); os.IsNotExist(err) {
+		u = ks.Create(FileKeeperIdentity, passphrase)
+	} else {
+		u = ks.Load(FileKeeperIdentity, passphrase)
+	}
+	if u == nil {
+		return nil
+	}
+	defer u.Destroy()
+	return u.SigningKey()
+}
+
+//Load read an identity from the keystore
+//name name of the identity
+//passphrase passphrase protecting the keystore file
+//return the user, nil if it cannot be decrypted
+func (ks Keystore) Load(name, passphrase string) *User {
+	return ImportUser(ks.KeyPath(name), passphrase)
+}
+
+//Save overwrite the keystore file of an identity
+//used to persist the list of owned blocks after adding new ones
+//name name of the identity
+//u user to save
+//passphrase passphrase protecting the keystore file
+//return true if the file was written successfully
+func (ks Keystore) Save(name string, u *User, passphrase string) bool {
+	return u.Export(ks.KeyPath(name), passphrase)
+}
+
+//List list the identities in the keystore
+//return a map from identity names to hex encoded public keys
+func (ks Keystore) List() map[string]string {
+	files, err := filepath.Glob(filepath.Join(ks.Path, "*"+KeystoreExt))
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	ids := make(map[string]string)
+	for _, path := range files {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Println("File reading error", err)
+			continue
+		}
+		pk := readKeystoreHeader(content)
+		if pk == nil {
+			continue
+		}
+		ids[strings.TrimSuffix(filepath.Base(path), KeystoreExt)] = hex.EncodeToString(pk.Bytes())
+	}
+	return ids
+}
+
+//Backup copy the encrypted keystore file of an identity
+//the backup is still protected by the same passphrase
+//name name of the identity
+//out path of the backup file
+//return true if the backup was written successfully
+func (ks Keystore) Backup(name, out string) bool {
+	content, err := ioutil.ReadFile(ks.KeyPath(name))
+	if err != nil {
+		fmt.Println("File reading error", err)
+		return false
+	}
+	if readKeystoreHeader(content) == nil {
+		return false
+	}
+	return replaceFile(out, content, 0600)
+}
+
+//Restore add to the keystore an identity saved with Backup
+//the identity is still protected by the passphrase of the backup,
+//existing identities are never overwritten
+//name name of the restored identity
+//in path of the backup file
+//return true if the identity was restored successfully
+func (ks Keystore) Restore(name, in string) bool {
+	content, err := ioutil.ReadFile(in)
+	if err != nil {
+		fmt.Println("File reading error", err)
+		return false
+	}
+	if readKeystoreHeader(content) == nil {
+		return false
+	}
+	path := ks.newKeyPath(name)
+	return path != "" && replaceFile(path, content, 0600)
+}
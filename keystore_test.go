@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportBlockCount(t *testing.T) {
+	Group = testGroup{}
+	u := GenUser()
+	u.Blocks = []int64{1, 2}
+	path := filepath.Join(t.TempDir(), "user.key")
+	if !u.Export(path, "pass") || ImportUser(path, "pass") == nil {
+		t.Fatal("keystore not written")
+	}
+	//a count whose byte size wraps around to the real size of the list
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerLen := len(keystoreMagic) + keystoreHeaderLen()
+	header := content[:headerLen]
+	salt := header[len(keystoreMagic)+1 : len(keystoreMagic)+1+saltLen]
+	nonce := header[len(keystoreMagic)+1+saltLen : len(keystoreMagic)+1+saltLen+nonceLen]
+	aead := keystoreCipher("pass", salt)
+	plain, err := aead.Open(nil, nonce, content[headerLen:], header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.BigEndian.PutUint64(plain[2*Group.ScalarLen():], 1<<61+2)
+	forged := aead.Seal(append([]byte{}, header...), nonce, plain, header)
+	if err = ioutil.WriteFile(path, forged, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if ImportUser(path, "pass") != nil {
+		t.Fatal("block count not bounded by the payload")
+	}
+}
+
+func TestFileKeeperSigner(t *testing.T) {
+	Group = testGroup{}
+	ks := Keystore{t.TempDir()}
+	key := ks.FileKeeperSigner("secret")
+	if key == nil {
+		t.Fatal("signing key not created")
+	}
+	//the key is loaded, not regenerated, on the next run
+	if loaded := ks.FileKeeperSigner("secret"); loaded == nil || !bytes.Equal(loaded.Public, key.Public) {
+		t.Fatal("signing key not persisted")
+	}
+	if ks.FileKeeperSigner("wrong") != nil {
+		t.Fatal("signing key loaded with a wrong passphrase")
+	}
+	//the key does not depend on the hash function of the ledger
+	defer SetAlgorithms(HashName, XOFName)
+	if !SetAlgorithms("sha-512", XOFName) {
+		t.Fatal("algorithms not set")
+	}
+	if loaded := ks.FileKeeperSigner("secret"); loaded == nil || !bytes.Equal(loaded.Public, key.Public) {
+		t.Fatal("signing key changed with the hash function")
+	}
+}
+
+func TestKeystoreRestore(t *testing.T) {
+	Group = testGroup{}
+	ks := Keystore{t.TempDir()}
+	u := ks.Create("alice", "secret")
+	if u == nil {
+		t.Fatal("identity not created")
+	}
+	u.Blocks = []int64{3}
+	backup := filepath.Join(t.TempDir(), "alice.bak")
+	if !ks.Save("alice", u, "secret") || !ks.Backup("alice", backup) {
+		t.Fatal("identity not saved")
+	}
+	//the backup is restored in another keystore, existing identities are kept
+	other := Keystore{t.TempDir()}
+	if !other.Restore("alice", backup) || other.Restore("alice", backup) || ks.Restore("alice", backup) {
+		t.Fatal("identity not restored only once")
+	}
+	restored := other.Load("alice", "secret")
+	if restored == nil || !restored.PublicKey.Equals(u.PublicKey) || len(restored.Blocks) != 1 || restored.Blocks[0] != 3 {
+		t.Fatal("restored identity differs")
+	}
+	//a file that is not a keystore is refused
+	if other.Restore("bob", filepath.Join(ks.Path, "missing")) || other.Restore("bob", newTestFile(t, 200)) {
+		t.Fatal("invalid backup restored")
+	}
+	//no temporary file is left in the keystore
+	if matches, err := filepath.Glob(filepath.Join(ks.Path, "*.tmp-*")); err != nil || len(matches) > 0 {
+		t.Fatal("temporary files left:", matches)
+	}
+}
@@ -0,0 +1,40 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+//acquireLock take an exclusive advisory lock on a file
+//blocks until the lock is available, the lock is held by the open file so
+//concurrent goroutines and processes exclude each other
+//path path to the lock file, created if missing
+//return the open lock file, nil on failure
+func acquireLock(path string) *os.File {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		fmt.Println("Error opening lock file:", err)
+		return nil
+	}
+	if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		fmt.Println("Error locking file:", err)
+		file.Close()
+		return nil
+	}
+	return file
+}
+
+//releaseLock release a lock taken with acquireLock
+//file open lock file
+func releaseLock(file *os.File) {
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_UN); err != nil {
+		fmt.Println("Error unlocking file:", err)
+	}
+	if err := file.Close(); err != nil {
+		fmt.Println("Error closing file:", err)
+	}
+}
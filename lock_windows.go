@@ -0,0 +1,40 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+//acquireLock take an exclusive lock creating a file that must not exist
+//blocks until the lock is available, concurrent goroutines and processes
+//exclude each other; a lock file left by a crashed process must be removed by hand
+//path path to the lock file
+//return the open lock file, nil on failure
+func acquireLock(path string) *os.File {
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return file
+		}
+		if !os.IsExist(err) {
+			fmt.Println("Error opening lock file:", err)
+			return nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+//releaseLock release a lock taken with acquireLock
+//file open lock file
+func releaseLock(file *os.File) {
+	if err := file.Close(); err != nil {
+		fmt.Println("Error closing file:", err)
+	}
+	if err := os.Remove(file.Name()); err != nil {
+		fmt.Println("Error removing lock file:", err)
+	}
+}
@@ -2,30 +2,61 @@ package main
 
 import (
 	"bufio"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
-
-	curve "github.com/gaetanorusso/public_ledger_sensitive_data/miracl/go/core/BN254"
 )
 
 //default path of settings file
 const defSettings string = "test/settings.txt"
 
+//default path of keystore folder
+const defKeystore string = "test/keystore"
+
 func main() {
 	/* try this if you want to test */
 	fmt.Println("Private Ledger: Welcome!")
 	//flag -settings to set up the test
 	settings := flag.String("settings", defSettings, "settings file path")
+	//flag -keystore to choose where identities are stored
+	keystore := flag.String("keystore", defKeystore, "keystore folder path")
 	flag.Parse()
-	//load settings
-	ledger := LoadSettings(*settings)
+	//run a command if requested, otherwise run the test
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "keystore":
+			KeystoreCommand(Keystore{*keystore}, flag.Args()[1:])
+		case "register":
+			RegisterCommand(LoadSettings(*settings), Keystore{*keystore}, flag.Args()[1:])
+		case "registry":
+			RegistryCommand(LoadSettings(*settings), flag.Args()[1:])
+		case "revoke":
+			RevokeCommand(LoadSettings(*settings), Keystore{*keystore}, flag.Args()[1:])
+		case "audit":
+			AuditCommand(LoadSettings(*settings), flag.Args()[1:])
+		case "signatures":
+			SignaturesCommand(LoadSettings(*settings), flag.Args()[1:])
+		case "bench":
+			//only the pairing group and the algorithms of the settings are used
+			LoadSettings(*settings)
+			BenchCommand(flag.Args()[1:])
+		default:
+			fmt.Println("Unknown command:", flag.Arg(0))
+			os.Exit(2)
+		}
+		return
+	}
+	//load settings, the ledger is created again so the parameters of
+	//the previous one are not applied
+	ledger := ReadSettings(*settings)
 	fmt.Println("Loaded settings from:", *settings)
 	//reset files
-	toClean := []string{ledger.KeysFile, ledger.ShardsFile}
+	toClean := []string{ledger.KeysFile, ledger.ShardsFile, ledger.RegistryFile, ledger.ParamsFile, ledger.AuditFile}
 	for _, filename := range toClean {
 		err := os.Remove(filename)
 		if err != nil {
@@ -37,10 +68,28 @@ func main() {
 	startTime := time.Now()
 	s := ledger.Init()
 	fmt.Println("Completed in", time.Now().Sub(startTime).Seconds(), "s")
-	//generate user keys
+	//the signing key of the filekeeper is kept in the keystore,
+	//and pinned to verify the checkpoints if the settings do not pin one
+	signer := Keystore{*keystore}.FileKeeperSigner(ReadPassphrase("Passphrase for " + FileKeeperIdentity + ": "))
+	if signer == nil {
+		panic("Filekeeper signing key not available!")
+	}
+	if ledger.FileKeeperKey == nil {
+		ledger.FileKeeperKey = signer.Public
+	}
+	fk := NewFileKeeper(ledger, s)
+	fk.RequireRegistration = true
+	if !fk.SetSigner(signer) || !fk.Checkpoint() {
+		panic("Audit log not writable!")
+	}
+	//generate user keys and register them
 	u := GenUser()
+	identity := "test-user"
+	if !ledger.Register(identity, *u) {
+		panic("Registration failed!")
+	}
 	//compute encryption token
-	token := TokenGen(u.PublicKey, s)
+	token := fk.TokenGen(u.PublicKey)
 	//ask the user which file to encrypt
 	reader := bufio.NewReader(os.Stdin)
 	defFile := "docs/private-ledger.pdf"
@@ -53,45 +102,105 @@ func main() {
 	//add a block
 	fmt.Println("Encrypting file", path)
 	startTime = time.Now()
-	index := u.AddBlock(ledger, token, path)
+	index := u.AddBlockWith(ledger, token, path, BlockOptions{Author: IdentityAuthor(identity), Sign: true})
 	fmt.Println("Block added with index", index)
 	fmt.Println("Completed in", time.Now().Sub(startTime).Seconds(), "s")
 	//unlock key from the ledger
-	unlocked := u.UnlockKey(ledger.GetEncKey(index))
+	keyEnc := ledger.GetEncKey(index)
+	if keyEnc == nil {
+		panic("Error reading encapsulated key!")
+	}
+	unlocked := u.UnlockKey(keyEnc)
+	if unlocked == nil {
+		panic("Error unlocking key!")
+	}
 	//decrypt file
 	decPath := "test/dec"
 	fmt.Println("Testing decryption to", decPath)
 	startTime = time.Now()
-	ledger.DecryptBlock(index, unlocked, decPath)
+	//DecryptBlock panics if the decryption is not consistent,
+	//the metadata is nil for blocks without it
+	meta := ledger.DecryptBlock(index, unlocked, decPath)
 	fmt.Println("Decryption Successful!")
+	if meta != nil {
+		fmt.Printf("Original file %s (%s, %d bytes, %s)\n", meta.Name, meta.MIMEType, meta.Size, meta.Created.Format(time.RFC3339))
+	} else {
+		fmt.Println("Original file without metadata")
+	}
 	fmt.Println("Completed in", time.Now().Sub(startTime).Seconds(), "s")
-	//update ledger
+	unlocked.Wipe()
+	//update ledger, the old time-key is wiped
 	fmt.Println("Initiating ledger update...")
+	oldKey := hex.EncodeToString(s.Bytes())
 	startTime = time.Now()
-	sNew := ledger.Update(s)
+	sNew := fk.Update()
+	if sNew == nil {
+		panic("Update failed!")
+	}
 	fmt.Println("Completed in", time.Now().Sub(startTime).Seconds(), "s")
 	//compare time keys
 	fmt.Println("Time keys:")
-	fmt.Println(s.ToString())
-	fmt.Println(sNew.ToString())
+	fmt.Println(oldKey)
+	fmt.Println(hex.EncodeToString(sNew.Bytes()))
 	//get updated encapsulated key from ledger
 	keyEncNew := ledger.GetEncKey(index)
+	if keyEncNew == nil {
+		panic("Error reading encapsulated key!")
+	}
 	//unlock key
 	unlockedNew := u.UnlockKey(keyEncNew)
+	if unlockedNew == nil {
+		panic("Error unlocking key!")
+	}
 	//decrypt file again
 	decPath = "test/dec2"
 	fmt.Println("Testing decryption to", decPath)
 	startTime = time.Now()
-	ledger.DecryptBlock(index, unlockedNew, decPath)
+	//the metadata is still readable with the updated key
+	if metaNew := ledger.DecryptBlock(index, unlockedNew, decPath); (metaNew == nil) != (meta == nil) {
+		panic("Inconsistent metadata after the update!")
+	}
 	fmt.Println("Decryption Successful!")
 	fmt.Println("Completed in", time.Now().Sub(startTime).Seconds(), "s")
+	//wipe the secrets
+	unlockedNew.Wipe()
+	u.Destroy()
+	fk.Destroy()
 }
 
 //LoadSettings load settings for test from file
+//the number of shards, the algorithms and the pairing group of an existing
+//ledger are read from its parameters and replace the settings
 //settingsFile path to settings file
 //returns a ledger struct
-//also modifies global variables ShardSize and MaxShards
+//also modifies global variables ShardSize and MaxShards, and the algorithms and pairing group in use
 func LoadSettings(settingsFile string) Ledger {
+	ledger := ReadSettings(settingsFile)
+	//shards added by ExtendShards are recorded in the ledger parameters
+	if _, err := os.Stat(ledger.ParamsFile); err == nil {
+		if n := ledger.NumShards(); n > 0 {
+			MaxShards = n
+		}
+		//the algorithms and the group of an existing ledger cannot change
+		if !ledger.LoadAlgorithms() {
+			panic("Incorrect ledger parameters: unknown hash or XOF")
+		}
+		if !ledger.LoadGroup() {
+			panic("Incorrect ledger parameters: unknown pairing group")
+		}
+	}
+	if PadSize < 2*Group.ScalarLen() {
+		panic("Incorrect settings: Pad size outside limits")
+	}
+	return ledger
+}
+
+//ReadSettings read settings for test from file
+//the parameters of an existing ledger are not read, used to create a new one
+//settingsFile path to settings file
+//returns a ledger struct
+//also modifies global variables ShardSize and MaxShards, and the algorithms and pairing group in use
+func ReadSettings(settingsFile string) Ledger {
 	//open settings file
 	file, err := os.Open(settingsFile)
 	if err != nil {
@@ -113,9 +222,6 @@ func LoadSettings(settingsFile string) Ledger {
 	if err != nil {
 		panic(err)
 	}
-	if PadSize < int(2*curve.MODBYTES) {
-		panic("Incorrect settings: Pad size outside limits")
-	}
 	//read number of shards to create
 	if !scanner.Scan() {
 		panic(scanner.Err())
@@ -144,6 +250,50 @@ func LoadSettings(settingsFile string) Ledger {
 		panic(scanner.Err())
 	}
 	encryptPath := scanner.Text()
-	//return ledger
-	return Ledger{shardsFile, keysFile, rootPath, encryptPath}
+	//optional paths, by default in the same folder of keysFile
+	optional := func(name string) string {
+		if scanner.Scan() && scanner.Text() != "" {
+			return scanner.Text()
+		}
+		return filepath.Join(filepath.Dir(keysFile), name)
+	}
+	registryFile := optional("registry.enc")
+	paramsFile := optional("params.txt")
+	auditFile := optional("audit.log")
+	//optional algorithms, by default SHA3-512 and SHAKE256
+	hashName, xofName := HashName, XOFName
+	if scanner.Scan() && scanner.Text() != "" {
+		hashName = scanner.Text()
+	}
+	if scanner.Scan() && scanner.Text() != "" {
+		xofName = scanner.Text()
+	}
+	if !SetAlgorithms(hashName, xofName) {
+		panic("Incorrect settings: unknown hash or XOF")
+	}
+	//optional pairing group, by default BN254
+	if scanner.Scan() && scanner.Text() != "" && !SetGroup(scanner.Text()) {
+		panic("Incorrect settings: unknown pairing group")
+	}
+	//optional pinned public key of the filekeeper
+	var fkKey []byte
+	if scanner.Scan() && scanner.Text() != "" {
+		if fkKey = decodeSigPub(scanner.Text()); fkKey == nil {
+			panic("Incorrect settings: invalid filekeeper key")
+		}
+	}
+	ledger := Ledger{
+		ShardsFile:    shardsFile,
+		KeysFile:      keysFile,
+		RootPath:      rootPath,
+		EncryptPath:   encryptPath,
+		RegistryFile:  registryFile,
+		ParamsFile:    paramsFile,
+		AuditFile:     auditFile,
+		FileKeeperKey: fkKey,
+	}
+	if PadSize < 2*Group.ScalarLen() {
+		panic("Incorrect settings: Pad size outside limits")
+	}
+	return ledger
 }
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+//MetadataExt extension of the file with the encrypted metadata of a ciphertext
+const MetadataExt = ".meta"
+
+//MetadataNonceLen byte size of the AES-GCM nonce of the metadata
+const MetadataNonceLen = 12
+
+//sniffLen number of bytes read from the start of a file to detect its type
+const sniffLen = 512
+
+//fileSignatures MIME types of the files starting with a known signature
+var fileSignatures = []struct {
+	magic    string
+	mimeType string
+}{
+	{"%PDF-", "application/pdf"},
+	{"\x89PNG\r\n\x1a\n", "image/png"},
+	{"\xff\xd8\xff", "image/jpeg"},
+	{"GIF87a", "image/gif"},
+	{"GIF89a", "image/gif"},
+	{"PK\x03\x04", "application/zip"},
+	{"\x1f\x8b\x08", "application/x-gzip"},
+}
+
+//sniffType detect the MIME type of a file from its first bytes
+//files with a known signature get its type, files that are valid UTF-8
+//without control characters are text, every other file is binary
+//head first bytes of the file, at most sniffLen
+//return the MIME type
+func sniffType(head []byte) string {
+	for _, sig := range fileSignatures {
+		if bytes.HasPrefix(head, []byte(sig.magic)) {
+			return sig.mimeType
+		}
+	}
+	//a multi-byte character can be cut at the end of a full head
+	text := head
+	for i := 1; len(head) == sniffLen && i < utf8.UTFMax && !utf8.Valid(text); i++ {
+		text = head[:len(head)-i]
+	}
+	if !utf8.Valid(text) {
+		return "application/octet-stream"
+	}
+	for _, c := range text {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f' {
+			return "application/octet-stream"
+		}
+	}
+	return "text/plain; charset=utf-8"
+}
+
+//Metadata struct that contains the metadata of an encrypted file
+//Created is the modification time of the file when it was added,
+//the creation time is not available on every system
+type Metadata struct {
+	Name     string
+	MIMEType string
+	Size     int64
+	Created  time.Time
+}
+
+//FileMetadata collect the metadata of a file
+//fileName path to the file
+//return the metadata, nil on failure
+func FileMetadata(fileName string) *Metadata {
+	fi, err := os.Stat(fileName)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	mimeType := mime.TypeByExtension(filepath.Ext(fileName))
+	if mimeType == "" {
+		//sniff the start of the content
+		file, err := os.Open(fileName)
+		if err != nil {
+			fmt.Println("Error opening file:", err)
+			return nil
+		}
+		head := make([]byte, sniffLen)
+		n, err := io.ReadFull(file, head)
+		file.Close()
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			fmt.Println("Error reading file:", err)
+			return nil
+		}
+		mimeType = sniffType(head[:n])
+	}
+	return &Metadata{
+		Name:     filepath.Base(fileName),
+		MIMEType: mimeType,
+		Size:     fi.Size(),
+		Created:  fi.ModTime(),
+	}
+}
+
+//ToBytes encode the metadata
+//name and MIME type are prefixed by their length (2 bytes big endian),
+//followed by size and creation time in nanoseconds (8 bytes each)
+//return the encoded metadata
+func (meta Metadata) ToBytes() []byte {
+	var encoded bytes.Buffer
+	for _, field := range []string{meta.Name, meta.MIMEType} {
+		binary.Write(&encoded, binary.BigEndian, uint16(len(field)))
+		encoded.WriteString(field)
+	}
+	binary.Write(&encoded, binary.BigEndian, meta.Size)
+	binary.Write(&encoded, binary.BigEndian, meta.Created.UnixNano())
+	return encoded.Bytes()
+}
+
+//MetadataFromBytes decode the metadata
+//encoded encoded metadata
+//return the metadata, nil if malformed
+func MetadataFromBytes(encoded []byte) *Metadata {
+	var fields [2]string
+	for i := range fields {
+		if len(encoded) < 2 || len(encoded) < 2+int(binary.BigEndian.Uint16(encoded)) {
+			fmt.Println("Error decoding metadata: incomplete metadata!")
+			return nil
+		}
+		n := 2 + int(binary.BigEndian.Uint16(encoded))
+		fields[i] = string(encoded[2:n])
+		encoded = encoded[n:]
+	}
+	if len(encoded) != 16 {
+		fmt.Println("Error decoding metadata: incomplete metadata!")
+		return nil
+	}
+	return &Metadata{
+		Name:     fields[0],
+		MIMEType: fields[1],
+		Size:     int64(binary.BigEndian.Uint64(encoded)),
+		Created:  time.Unix(0, int64(binary.BigEndian.Uint64(encoded[8:]))),
+	}
+}
+
+//metadataCipher create the cipher of the metadata of a file
+//the AES key is derived with its own domain tag, see fileKey
+//eps first masking shard of the file
+//key encryption key of the file
+//return the AES-GCM cipher, nil on failure
+func metadataCipher(eps G2, key G1) cipher.AEAD {
+	derived := fileKey(eps, key, "metadata")
+	defer Wipe(derived)
+	block, err := aes.NewCipher(derived[:32])
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return aead
+}
+
+//sealMetadata encrypt the metadata of a file
+//meta metadata to encrypt
+//eps first masking shard of the file
+//key encryption key of the file
+//nonce random nonce of MetadataNonceLen bytes
+//return nonce and ciphertext, nil on failure
+func sealMetadata(meta Metadata, eps G2, key G1, nonce []byte) []byte {
+	aead := metadataCipher(eps, key)
+	if aead == nil || len(nonce) != aead.NonceSize() {
+		return nil
+	}
+	return aead.Seal(append([]byte{}, nonce...), nonce, meta.ToBytes(), nil)
+}
+
+//openMetadata decrypt the metadata of a file
+//sealed nonce and ciphertext
+//eps first masking shard of the file
+//key encryption key of the file
+//return the metadata, nil on failure
+func openMetadata(sealed []byte, eps G2, key G1) *Metadata {
+	aead := metadataCipher(eps, key)
+	if aead == nil {
+		return nil
+	}
+	if len(sealed) < aead.NonceSize() {
+		fmt.Println("Error decrypting metadata: incomplete metadata!")
+		return nil
+	}
+	encoded, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		fmt.Println("Error decrypting metadata:", err)
+		return nil
+	}
+	return MetadataFromBytes(encoded)
+}
+
+//MetadataName compute the path of the encrypted metadata of a ciphertext
+//index index of the ciphertext
+//return the path of the file
+func (ledger Ledger) MetadataName(index int64) string {
+	return ledger.EncryptPath + strconv.FormatInt(index, 16) + MetadataExt
+}
+
+//checkMetadata check that the encrypted metadata of a block match its digest
+//index index of the block
+//block block committing to the metadata
+//return true if the block has no metadata or they match
+func (ledger Ledger) checkMetadata(index int64, block *Block) bool {
+	digest, ok := block.Fields[FieldMetadata]
+	if !ok {
+		return true
+	}
+	return bytes.Equal(FileDigest(ledger.MetadataName(block.CiphertextIndex(index))), digest)
+}
+
+//GetMetadata decrypt the metadata of a block
+//index index of the block
+//	for shared keys it is the index of the first part of the shared key
+//unlocked unlocked key for decryption
+//return the metadata, nil if the block has none or on failure
+func (ledger Ledger) GetMetadata(index int64, unlocked G1) *Metadata {
+	block := ledger.GetBlock(index)
+	if block == nil {
+		return nil
+	}
+	if _, ok := block.Fields[FieldMetadata]; !ok {
+		return nil
+	}
+	if !ledger.checkMetadata(index, block) {
+		fmt.Println("Metadata do not match block", index)
+		return nil
+	}
+	sealed, err := ioutil.ReadFile(ledger.MetadataName(block.CiphertextIndex(index)))
+	if err != nil {
+		fmt.Println("File reading error", err)
+		return nil
+	}
+	eps := ledger.Shard(0)
+	if eps == nil {
+		return nil
+	}
+	return openMetadata(sealed, eps, unlocked)
+}
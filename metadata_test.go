@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSniffType(t *testing.T) {
+	//a text whose last character is cut by the sniffed head
+	cut := append(bytes.Repeat([]byte("a"), sniffLen-1), "è"...)[:sniffLen]
+	cases := []struct {
+		head     []byte
+		mimeType string
+	}{
+		{[]byte("%PDF-1.7\n"), "application/pdf"},
+		{[]byte("\x89PNG\r\n\x1a\n\x00\x00"), "image/png"},
+		{[]byte("plain text\n"), "text/plain; charset=utf-8"},
+		{[]byte{}, "text/plain; charset=utf-8"},
+		{cut, "text/plain; charset=utf-8"},
+		{[]byte{0x00, 0x01, 0x02}, "application/octet-stream"},
+		{[]byte{'a', 0xff, 'b'}, "application/octet-stream"},
+	}
+	for _, c := range cases {
+		if got := sniffType(c.head); got != c.mimeType {
+			t.Errorf("%q detected as %s, expected %s", c.head, got, c.mimeType)
+		}
+	}
+}
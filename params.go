@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//names of the ledger parameters
+const (
+	//ParamEpoch number of updates since the initialisation of the ledger
+	ParamEpoch = "epoch"
+)
+
+//ReadParams read the parameters of the ledger
+//each line of the parameters file contains a name and a value
+//ledgers created before the parameters file have none: they are at
+//epoch 0 with the default shards, algorithms and group
+//the parameters file path is taken from Ledger struct
+//return the parameters, empty if the file does not exist,
+//nil if the file cannot be read
+func (ledger Ledger) ReadParams() map[string]string {
+	file, err := os.Open(ledger.ParamsFile)
+	if os.IsNotExist(err) {
+		return make(map[string]string)
+	}
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return nil
+	}
+	//close file on exit
+	defer func() {
+		if err = file.Close(); err != nil {
+			fmt.Println("Error closing file:", err)
+		}
+	}()
+	params := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		params[fields[0]] = strings.Join(fields[1:], " ")
+	}
+	if err = scanner.Err(); err != nil {
+		fmt.Println("Error reading file:", err)
+		return nil
+	}
+	return params
+}
+
+//replaceFile replace the content of a file atomically
+//the content is written to a temporary file with a unique name in the same
+//directory, synced and renamed over the file, so that a crash or a
+//concurrent writer never leaves a partial file
+//path path of the file
+//content new content
+//perm permissions of the file
+//return true if the file was replaced successfully
+func replaceFile(path string, content []byte, perm os.FileMode) bool {
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return false
+	}
+	_, err = temp.Write(content)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if cerr := temp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		fmt.Println("Error writing file:", err)
+		os.Remove(temp.Name())
+		return false
+	}
+	return true
+}
+
+//WriteParams write the parameters of the ledger
+//the file is replaced atomically
+//params parameters to write
+//return true if the parameters were written successfully
+func (ledger Ledger) WriteParams(params map[string]string) bool {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var content strings.Builder
+	for _, name := range names {
+		content.WriteString(name + " " + params[name] + "\n")
+	}
+	return replaceFile(ledger.ParamsFile, []byte(content.String()), 0644)
+}
+
+//SetParam change a single parameter of the ledger
+//the other parameters are kept, nothing is written if they cannot be read
+//name name of the parameter
+//value new value
+//return true if the parameter was written successfully
+func (ledger Ledger) SetParam(name, value string) bool {
+	params := ledger.ReadParams()
+	if params == nil {
+		return false
+	}
+	params[name] = value
+	return ledger.WriteParams(params)
+}
+
+//Epoch read the current epoch of the ledger
+//ledgers without the parameter have never been updated since it exists
+//return the number of updates since the initialisation, -1 on failure
+func (ledger Ledger) Epoch() int64 {
+	params := ledger.ReadParams()
+	if params == nil {
+		return -1
+	}
+	encoded, ok := params[ParamEpoch]
+	if !ok {
+		return 0
+	}
+	epoch, err := strconv.ParseInt(encoded, 10, 64)
+	if err != nil {
+		fmt.Println("Error reading epoch:", err)
+		return -1
+	}
+	return epoch
+}
@@ -1,20 +1,20 @@
 package main
 
 import (
-	"crypto/rand"
 	"fmt"
+	"io"
 	"io/ioutil"
 
-	curve "github.com/gaetanorusso/public_ledger_sensitive_data/miracl/go/core/BN254"
 	"golang.org/x/crypto/sha3"
 )
 
 //constants
 
-//BITLEN curve bn254 modulus bit len
-const BITLEN = 254
-
 //HashLen size of hash digest in bytes
+//the digest size is part of the file formats (blocks, audit log,
+//checkpoints), so only hash functions with 64 bytes digests can be
+//added to HashAlgorithms; a shorter function must be extended to 64 bytes
+//as shake256 is, with a new identifier
 const HashLen = 64
 
 //Hash hash function used for integrity Checks
@@ -29,37 +29,17 @@ var MapHash func([]byte, []byte) = sha3.ShakeSum256
 //MaxShards maximum number of shards
 var MaxShards = 10000
 
-//MOD modulus of curve
-var MOD *curve.BIG = curve.NewBIGints(curve.Modulus)
-
-//ORDER order of curve
-var ORDER *curve.BIG = curve.NewBIGints(curve.CURVE_Order)
-
-//B1 G1 generator
-var B1 *curve.ECP = curve.ECP_generator()
-
-//B2 G2 generator
-var B2 *curve.ECP2 = curve.ECP2_generator()
-
-//FP12LEN array len FP12 elements
-const FP12LEN = curve.MODBYTES*11 + 32
-
 //GenExp generate cryptographically secure random exponent
-//result uniform in [2..ORDER-1]
-func GenExp() *curve.BIG {
-	entropy := make([]byte, curve.MODBYTES)
-	r := curve.NewBIGint(0)
-	//continue generating until the value is in [2..ORDER-1]
-	for curve.Comp(r, curve.NewBIGint(1)) <= 0 {
-		_, err := rand.Read(entropy)
-		if err != nil {
-			fmt.Println("Error generating random exponent:", err)
-			panic(err)
-		}
-		r = curve.FromBytes(entropy)
-		r.Mod(ORDER)
-	}
-	return r
+//result uniform in [2..order-1] of the pairing group in use
+func GenExp() Scalar {
+	return GenExpFrom(nil)
+}
+
+//GenExpFrom generate a random exponent reading from a source of randomness
+//rng source of randomness, nil to use crypto/rand
+//result uniform in [2..order-1] of the pairing group in use
+func GenExpFrom(rng io.Reader) Scalar {
+	return Group.RandomScalar(entropy(rng))
 }
 
 //shardUpdate update a masking shard
@@ -68,28 +48,26 @@ func GenExp() *curve.BIG {
 //s old time-key
 //sNew new time-key
 //returns shard struct with same index and the encoding of the new masking shard
-func shardUpdate(index int, old *curve.ECP2, s, sNew *curve.BIG) shard {
-	inv := curve.NewBIGcopy(s)
-	inv.Invmodp(ORDER)
-	new := curve.G2mul(old, sNew)
-	new = curve.G2mul(new, inv)
-	//encode
-	encoded := make([]byte, 2*curve.MODBYTES+1)
-	new.ToBytes(encoded, true)
-	return shard{index, string(encoded)}
+func shardUpdate(index int, old G2, s, sNew Scalar) shard {
+	inv := s.Inverse()
+	defer inv.Wipe()
+	new := old.Mul(sNew).Mul(inv)
+	return shard{index, string(new.Bytes())}
 }
 
 //FracMult multiplies element for fraction num/den
 //used both for updating keys, and for unlocking them for decryption
-//el ECP2 element to multiply
+//el G1 element to multiply
 //den denominator of the fraction
 //num numerator of the fraction
+//the inverse of den and the intermediate element are wiped
 //returns (num/den)*el
-func FracMult(el *curve.ECP, den, num *curve.BIG) *curve.ECP {
-	inv := curve.NewBIGcopy(den)
-	inv.Invmodp(ORDER)
-	result := curve.G1mul(el, inv)
-	result = curve.G1mul(result, num)
+func FracMult(el G1, den, num Scalar) G1 {
+	inv := den.Inverse()
+	partial := el.Mul(inv)
+	result := partial.Mul(num)
+	inv.Wipe()
+	partial.Wipe()
 	return result
 }
 
@@ -97,29 +75,51 @@ func FracMult(el *curve.ECP, den, num *curve.BIG) *curve.ECP {
 //pubKey public key of the user that requested the token
 //s time-key
 //returns the encryption token
-func TokenGen(pubKey *curve.ECP, s *curve.BIG) *curve.ECP {
-	inv := curve.NewBIGcopy(s)
-	inv.Invmodp(ORDER)
-	token := curve.G1mul(pubKey, inv)
-	return token
+func TokenGen(pubKey G1, s Scalar) G1 {
+	inv := s.Inverse()
+	defer inv.Wipe()
+	return pubKey.Mul(inv)
 }
 
-//HashAte computes the Ate-pairing, then it hash the result to create the pad
+//HashAte computes the pairing, then it hash the result to create the pad
 //eps masking shard
 //key encryption key
+//the pairing and its encoding are wiped, the caller wipes the pad
 //return the pad for encryption/decryption
-func HashAte(eps *curve.ECP2, key *curve.ECP) []byte {
-	var gtB [FP12LEN]byte
-	//NB: to compute the pairing correctly the final exp has to be done explicitly
-	gt := curve.Ate(eps, key)
-	gt = curve.Fexp(gt)
-	gt.ToBytes(gtB[:])
+func HashAte(eps G2, key G1) []byte {
+	gt := Group.Pair(eps, key)
+	encoded := gt.Bytes()
 	//apply uniform mapping
 	digest := make([]byte, PadSize)
-	MapHash(digest, gtB[:])
+	MapHash(digest, encoded)
+	Wipe(encoded)
+	gt.Wipe()
 	return digest
 }
 
+//fileKey derive a key bound to an encrypted file
+//the key is an output of the XOF on the pairing of the first masking shard
+//and the encryption key, like the pads, but prefixed by a domain tag,
+//so it is independent of the pads and of the keys with other tags
+//the pairing does not change with the updates, so the key is the same
+//in every epoch and known to whoever can decrypt the file
+//eps first masking shard of the file
+//key encryption key of the file
+//domain tag of the use of the key
+//return the key of HashLen bytes, the caller wipes it
+func fileKey(eps G2, key G1, domain string) []byte {
+	gt := Group.Pair(eps, key)
+	encoded := gt.Bytes()
+	input := append([]byte{byte(len(domain))}, domain...)
+	input = append(input, encoded...)
+	derived := make([]byte, HashLen)
+	MapHash(derived, input)
+	Wipe(input)
+	Wipe(encoded)
+	gt.Wipe()
+	return derived
+}
+
 //TruncXor xor byte slices truncating the longest
 //outputs the xor of the first n bytes of the two inputs
 //where n is the length of the shortest input
@@ -143,9 +143,10 @@ func TruncXor(a, b []byte) []byte {
 //eps masking shard
 //key encryption key
 //return the processed data
-func OneTimePad(data []byte, eps *curve.ECP2, key *curve.ECP) []byte {
+func OneTimePad(data []byte, eps G2, key G1) []byte {
 	h := HashAte(eps, key)
 	res := TruncXor(data, h[:]) //handle error
+	Wipe(h)
 	return res
 }
 
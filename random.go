@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gaetanorusso/public_ledger_sensitive_data/miracl/go/core"
+)
+
+//DRBG deterministic random bit generator of the vendored MIRACL core
+//the same seed always gives the same stream of bytes, so runs reading from it
+//in the same order are reproducible, e.g. for test vectors and bug reports
+//it is safe for concurrent use
+type DRBG struct {
+	mu  sync.Mutex
+	rng *core.RAND
+}
+
+//NewDRBG seed a deterministic random bit generator
+//seed seed of the generator, at least 128 bytes of real entropy
+//unless reproducibility is the goal
+//return the generator
+func NewDRBG(seed []byte) *DRBG {
+	rng := core.NewRAND()
+	rng.Seed(len(seed), seed)
+	return &DRBG{rng: rng}
+}
+
+//Read fill p with the next bytes of the generator
+//return len(p), never fails
+func (d *DRBG) Read(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range p {
+		p[i] = d.rng.GetByte()
+	}
+	return len(p), nil
+}
+
+//entropy choose the source of randomness
+//rng injected source, nil to use crypto/rand
+//return the source to read from
+func entropy(rng io.Reader) io.Reader {
+	if rng == nil {
+		return rand.Reader
+	}
+	return rng
+}
+
+//readRandom fill a new slice with random bytes
+//rng source of randomness, nil to use crypto/rand
+//n number of bytes
+//return the random bytes, nil on failure
+func readRandom(rng io.Reader, n int) []byte {
+	random := make([]byte, n)
+	if _, err := io.ReadFull(entropy(rng), random); err != nil {
+		fmt.Println("Error reading randomness:", err)
+		return nil
+	}
+	return random
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+//seededRun run Init, user generation, AddBlock and Update from fixed seeds
+//file plaintext to add
+//return the contents of shards file, key-file, ciphertext and block
+func seededRun(t *testing.T, file string) [][]byte {
+	ledger, fk := newTestLedgerFrom(t, testGroup{}, 8, NewDRBG([]byte("ledger seed")))
+	u := GenUserFrom(NewDRBG([]byte("user seed")))
+	index := u.AddBlock(ledger, fk.TokenGen(u.PublicKey), file)
+	if index < 0 || fk.Update() == nil {
+		t.Fatal("run failed")
+	}
+	var contents [][]byte
+	for _, name := range []string{ledger.ShardsFile, ledger.KeysFile, ledger.EncryptPath + "0.enc", ledger.BlockName(index)} {
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, content)
+	}
+	return contents
+}
+
+func TestReproducibleRuns(t *testing.T) {
+	file := newTestFile(t, 500)
+	first, second := seededRun(t, file), seededRun(t, file)
+	for i := range first {
+		if !bytes.Equal(first[i], second[i]) {
+			t.Fatal("runs with the same seeds differ in file", i)
+		}
+	}
+	a, b := NewDRBG([]byte("seed")), NewDRBG([]byte("other seed"))
+	if bytes.Equal(GenExpFrom(a).Bytes(), GenExpFrom(b).Bytes()) {
+		t.Fatal("different seeds give the same exponents")
+	}
+}
@@ -0,0 +1,615 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+//types of the registry entries
+const (
+	//EntryRegister registration of an identity and its public key
+	EntryRegister byte = 0
+	//EntryRevoke revocation of the write access of a public key
+	EntryRevoke byte = 1
+	//EntrySigner BLS key used by a registered identity to sign blocks
+	EntrySigner byte = 2
+)
+
+//ProofLen byte size of a proof of possession in the pairing group in use
+func ProofLen() int {
+	return Group.G1Len() + Group.ScalarLen()
+}
+
+//Registration struct that contains an identity registered on the ledger
+//Proof proves that the identity knows the private key of PublicKey
+//SigningKey is the BLS public key used by the identity to sign blocks,
+//nil if not registered, and SignerProof binds it to PublicKey, to the
+//identity and to SignerCounter, which grows with every new signing key
+type Registration struct {
+	Identity      string
+	PublicKey     G1
+	Proof         []byte
+	SigningKey    []byte
+	SignerProof   []byte
+	SignerCounter int64
+}
+
+//signerDomain domain separation tag of the proofs binding a signing key
+const signerDomain = "registry signing key"
+
+//Revocation struct that contains a revocation event recorded on the ledger
+//Epoch epoch of the ledger when the public key was revoked
+//Signature signature of the filekeeper on the revocation, nil if unsigned
+type Revocation struct {
+	PublicKey G1
+	Epoch     int64
+	Signature []byte
+}
+
+//hashToExp hash a list of values to an exponent
+//values byte slices to hash
+//return the digest reduced modulo the group order
+func hashToExp(values ...[]byte) Scalar {
+	h := Hash(bytes.Join(values, nil))
+	return Group.ScalarFromBytes(h[:Group.ScalarLen()])
+}
+
+//ProvePossession prove knowledge of the private key mu of the user
+//Schnorr proof on the public key bound to a message
+//message message the proof is bound to, e.g. the identity being registered
+//return the encoding of the proof: commitment R and response z
+func (u User) ProvePossession(message []byte) []byte {
+	k := GenExpFrom(u.Rand)
+	defer k.Wipe()
+	R := Group.G1Generator().Mul(k).Bytes()
+	//challenge c = H(R, pk, message), response z = k + c*mu
+	c := hashToExp(R, u.PublicKey.Bytes(), message)
+	z := k.Add(c.Mul(u.mu))
+	return append(R, z.Bytes()...)
+}
+
+//VerifyPossession verify a proof of possession
+//pubKey public key of the prover
+//message message the proof is bound to
+//proof encoded proof
+//return true if the proof is valid
+func VerifyPossession(pubKey G1, message, proof []byte) bool {
+	if len(proof) != ProofLen() {
+		return false
+	}
+	rLen := Group.G1Len()
+	R := Group.G1FromBytes(proof[:rLen])
+	if R == nil {
+		return false
+	}
+	z := Group.ScalarFromBytes(proof[rLen:])
+	c := hashToExp(proof[:rLen], pubKey.Bytes(), message)
+	//check z*G = R + c*pk
+	left := Group.G1Generator().Mul(z)
+	right := pubKey.Mul(c).Add(R)
+	return left.Equals(right)
+}
+
+//encodeRegistration encode a registration entry
+//reg registration the entry refers to
+//return the encoded entry
+func encodeRegistration(reg Registration) []byte {
+	encoded := append([]byte{EntryRegister}, reg.PublicKey.Bytes()...)
+	encoded = append(encoded, reg.Proof...)
+	return append(encoded, reg.Identity...)
+}
+
+//decodeRegistration decode a registration entry
+//encoded encoded entry
+//return the registration, nil if malformed
+func decodeRegistration(encoded []byte) *Registration {
+	pkEnd, proofLen := 1+Group.G1Len(), ProofLen()
+	if len(encoded) < pkEnd+proofLen {
+		fmt.Println("Error decoding registry entry: incomplete entry!")
+		return nil
+	}
+	pk := Group.G1FromBytes(encoded[1:pkEnd])
+	if pk == nil {
+		fmt.Println("Error decoding registry entry: invalid public key!")
+		return nil
+	}
+	proof := encoded[pkEnd : pkEnd+proofLen]
+	identity := string(encoded[pkEnd+proofLen:])
+	return &Registration{Identity: identity, PublicKey: pk, Proof: proof}
+}
+
+//signerMessage encode the message a signing key entry proves
+//the signing key is bound to the identity and to the counter of the entry,
+//so that an old entry cannot be replayed to restore a previous key
+//identity identity registered with the public key
+//counter counter of the entry
+//signingKey BLS public key of the entry
+//return the message of the proof of possession
+func signerMessage(identity string, counter int64, signingKey []byte) []byte {
+	message := append([]byte(signerDomain), encodeEpoch(int64(len(identity)))...)
+	message = append(message, identity...)
+	message = append(message, encodeEpoch(counter)...)
+	return append(message, signingKey...)
+}
+
+//encodeSigner encode a signing key entry
+//reg registration with the signing key
+//return the encoded entry
+func encodeSigner(reg Registration) []byte {
+	encoded := append([]byte{EntrySigner}, reg.PublicKey.Bytes()...)
+	encoded = append(encoded, encodeEpoch(reg.SignerCounter)...)
+	encoded = append(encoded, reg.SigningKey...)
+	return append(encoded, reg.SignerProof...)
+}
+
+//decodeSigner decode a signing key entry
+//entries written before the counter was introduced are decoded with
+//counter 0, their proof is on the signing key only
+//encoded encoded entry
+//return the public key and a registration containing only the signing key,
+//its proof and its counter, nil if malformed
+func decodeSigner(encoded []byte) *Registration {
+	pkEnd := 1 + Group.G1Len()
+	counterEnd := pkEnd
+	switch len(encoded) {
+	case pkEnd + 8 + SigPubLen + ProofLen():
+		counterEnd += 8
+	case pkEnd + SigPubLen + ProofLen():
+	default:
+		fmt.Println("Error decoding registry entry: incomplete entry!")
+		return nil
+	}
+	pk := Group.G1FromBytes(encoded[1:pkEnd])
+	if pk == nil {
+		fmt.Println("Error decoding registry entry: invalid public key!")
+		return nil
+	}
+	reg := &Registration{
+		PublicKey:   pk,
+		SigningKey:  encoded[counterEnd : counterEnd+SigPubLen],
+		SignerProof: encoded[counterEnd+SigPubLen:],
+	}
+	if counterEnd > pkEnd {
+		reg.SignerCounter = int64(binary.BigEndian.Uint64(encoded[pkEnd:]))
+	}
+	return reg
+}
+
+//validSigner check a signing key entry against the registration it refers to
+//the proof must bind the signing key to the identity and the counter, which
+//must be higher than the one of the current signing key; the entries
+//without counter are accepted only as first signing key
+//reg current registration of the public key
+//signer signing key entry
+//return true if the signing key replaces the current one
+func validSigner(reg Registration, signer Registration) bool {
+	message := signerMessage(reg.Identity, signer.SignerCounter, signer.SigningKey)
+	if signer.SignerCounter == 0 {
+		message = signer.SigningKey
+	}
+	if !VerifyPossession(signer.PublicKey, message, signer.SignerProof) {
+		return false
+	}
+	if reg.SigningKey != nil && signer.SignerCounter <= reg.SignerCounter {
+		fmt.Println("Replayed signing key entry of", reg.Identity)
+		return false
+	}
+	return true
+}
+
+//signedPart encode the fields of the revocation covered by the signature
+func (rev Revocation) signedPart() []byte {
+	encoded := append([]byte{EntryRevoke}, rev.PublicKey.Bytes()...)
+	return append(encoded, encodeEpoch(rev.Epoch)...)
+}
+
+//encodeRevocation encode a revocation entry
+//rev revocation the entry refers to
+//return the encoded entry
+func encodeRevocation(rev Revocation) []byte {
+	return append(rev.signedPart(), rev.Signature...)
+}
+
+//decodeRevocation decode a revocation entry
+//entries written before revocations were signed are decoded without signature
+//encoded encoded entry
+//return the revocation, nil if malformed
+func decodeRevocation(encoded []byte) *Revocation {
+	pkEnd := 1 + Group.G1Len()
+	if len(encoded) != pkEnd+8 && len(encoded) != pkEnd+8+SigLen {
+		fmt.Println("Error decoding registry entry: incomplete entry!")
+		return nil
+	}
+	pk := Group.G1FromBytes(encoded[1:pkEnd])
+	if pk == nil {
+		fmt.Println("Error decoding registry entry: invalid public key!")
+		return nil
+	}
+	epoch := int64(binary.BigEndian.Uint64(encoded[pkEnd:]))
+	var sig []byte
+	if len(encoded) > pkEnd+8 {
+		sig = encoded[pkEnd+8:]
+	}
+	return &Revocation{pk, epoch, sig}
+}
+
+//Registry struct that contains the registry read from the ledger
+//Registrations are the valid registrations in order, with their signing
+//keys, Revocations every revocation entry, signed or not, and Skipped the
+//number of invalid entries
+//the registry is read and verified once and then queried, e.g. for every
+//block checked by CheckConsistency
+type Registry struct {
+	Registrations []Registration
+	Revocations   []Revocation
+	Skipped       int
+	byIdentity    map[string]int
+	byKey         map[string]int
+}
+
+//ReadRegistry read and verify the entries of the registry
+//registrations without a valid proof of possession, or repeating an identity
+//or a public key already registered, are skipped, as are signing keys not
+//bound by a valid proof to a registered public key, or replaying an entry
+//not newer than the current signing key
+//the registry file path is taken from Ledger struct
+//return the registry, nil if it cannot be read
+func (ledger Ledger) ReadRegistry() *Registry {
+	records := ReadRecords(ledger.RegistryFile)
+	if records == nil {
+		return nil
+	}
+	registry := &Registry{
+		Registrations: []Registration{},
+		Revocations:   []Revocation{},
+		byIdentity:    make(map[string]int),
+		byKey:         make(map[string]int),
+	}
+	for _, record := range records {
+		if len(record) == 0 {
+			fmt.Println("Error decoding registry entry: empty entry!")
+			return nil
+		}
+		switch record[0] {
+		case EntryRegister:
+			reg := decodeRegistration(record)
+			if reg == nil {
+				return nil
+			}
+			if !registry.validRegistration(*reg) {
+				registry.Skipped++
+				continue
+			}
+			registry.byIdentity[reg.Identity] = len(registry.Registrations)
+			registry.byKey[keyID(reg.PublicKey)] = len(registry.Registrations)
+			registry.Registrations = append(registry.Registrations, *reg)
+		case EntryRevoke:
+			rev := decodeRevocation(record)
+			if rev == nil {
+				return nil
+			}
+			registry.Revocations = append(registry.Revocations, *rev)
+		case EntrySigner:
+			signer := decodeSigner(record)
+			if signer == nil {
+				return nil
+			}
+			//attach the signing key to the registration of the public key
+			//only if the owner of the public key proves to have chosen it
+			//after the current one
+			i, ok := registry.byKey[keyID(signer.PublicKey)]
+			if !ok || !validSigner(registry.Registrations[i], *signer) {
+				fmt.Println("Invalid signing key of", keyID(signer.PublicKey))
+				registry.Skipped++
+				continue
+			}
+			registry.Registrations[i].SigningKey = signer.SigningKey
+			registry.Registrations[i].SignerProof = signer.SignerProof
+			registry.Registrations[i].SignerCounter = signer.SignerCounter
+		default:
+			fmt.Println("Error decoding registry entry: unknown type", record[0])
+			return nil
+		}
+	}
+	return registry
+}
+
+//validRegistration check a registration entry against the previous ones
+//the entry must prove possession of its key, and neither its identity nor
+//its public key may be registered already: the first valid registration wins
+//reg registration to check
+//return true if the registration is valid
+func (registry *Registry) validRegistration(reg Registration) bool {
+	if reg.Identity == "" || !VerifyPossession(reg.PublicKey, []byte(reg.Identity), reg.Proof) {
+		fmt.Println("Invalid registration of identity:", reg.Identity)
+		return false
+	}
+	if registry.Lookup(reg.Identity) != nil || registry.IsRegistered(reg.PublicKey) {
+		fmt.Println("Duplicate registration of identity:", reg.Identity)
+		return false
+	}
+	return true
+}
+
+//Lookup find the registration of an identity
+//identity identity to look for
+//return the registration, nil if the identity is not registered
+func (registry *Registry) Lookup(identity string) *Registration {
+	i, ok := registry.byIdentity[identity]
+	if !ok {
+		return nil
+	}
+	reg := registry.Registrations[i]
+	return &reg
+}
+
+//IsRegistered check if a public key is registered
+//pubKey public key to look for
+//return true if some identity is registered with pubKey
+func (registry *Registry) IsRegistered(pubKey G1) bool {
+	return registry.lookupKey(pubKey) != nil
+}
+
+//lookupKey find the registration of a public key
+//pubKey public key to look for
+//return the registration, nil if the public key is not registered
+func (registry *Registry) lookupKey(pubKey G1) *Registration {
+	i, ok := registry.byKey[keyID(pubKey)]
+	if !ok {
+		return nil
+	}
+	reg := registry.Registrations[i]
+	return &reg
+}
+
+//Check check that the registry contains no invalid entry
+//return true if every entry of the registry is valid
+func (registry *Registry) Check() bool {
+	if registry.Skipped > 0 {
+		fmt.Println("Registry contains", registry.Skipped, "invalid entries")
+		return false
+	}
+	return true
+}
+
+//Registrations read the registered identities from the ledger
+//the registry file path is taken from Ledger struct
+//return the registrations in order, nil if the registry cannot be read
+func (ledger Ledger) Registrations() []Registration {
+	registry := ledger.ReadRegistry()
+	if registry == nil {
+		return nil
+	}
+	return registry.Registrations
+}
+
+//Revocations read the revocation events signed by the filekeeper
+//any writer can append to the registry, so revocations without a valid
+//signature are skipped
+//the registry file path is taken from Ledger struct
+//public public key of the filekeeper
+//return the revocations in order, nil if the registry cannot be read
+func (ledger Ledger) Revocations(public []byte) []Revocation {
+	return ledger.signedRevocations(public, nil)
+}
+
+//signedRevocations read the revocation events signed by the filekeeper
+//only the revocation entries are decoded, the registrations are not verified
+//public public key of the filekeeper
+//pubKey public key whose revocations are read, nil for every public key
+//return the revocations in order, nil if the registry cannot be read
+func (ledger Ledger) signedRevocations(public []byte, pubKey G1) []Revocation {
+	records := ReadRecords(ledger.RegistryFile)
+	if records == nil {
+		return nil
+	}
+	signed := []Revocation{}
+	for _, record := range records {
+		if len(record) == 0 || record[0] != EntryRevoke {
+			continue
+		}
+		rev := decodeRevocation(record)
+		if rev == nil {
+			return nil
+		}
+		if pubKey != nil && !rev.PublicKey.Equals(pubKey) {
+			continue
+		}
+		if !VerifySignature(public, rev.signedPart(), rev.Signature) {
+			fmt.Println("Invalid signature of the revocation of", keyID(rev.PublicKey))
+			continue
+		}
+		signed = append(signed, *rev)
+	}
+	return signed
+}
+
+//revocationKey read the public key the revocations on the ledger are
+//verified with: the pinned key of the Ledger struct or, if not pinned,
+//the key recorded in the ledger parameters; a forged recorded key can
+//only make the ledger refuse more public keys
+//return the public key, nil if there is none
+func (ledger Ledger) revocationKey() []byte {
+	if ledger.FileKeeperKey != nil {
+		return ledger.FileKeeperKey
+	}
+	params := ledger.ReadParams()
+	if params == nil || params[ParamFileKeeperKey] == "" {
+		return nil
+	}
+	return decodeSigPub(params[ParamFileKeeperKey])
+}
+
+//RevokedOnLedger check if the ledger records a revocation of a public key
+//signed by the filekeeper
+//revocations are verified with the key given by revocationKey, a ledger
+//without filekeeper key has no valid revocation
+//pubKey public key to check
+//public public key of the filekeeper, nil to use revocationKey
+//return true if the public key is revoked or the registry cannot be read
+func (ledger Ledger) RevokedOnLedger(pubKey G1, public []byte) bool {
+	if public == nil {
+		public = ledger.revocationKey()
+	}
+	if public == nil {
+		return false
+	}
+	revs := ledger.signedRevocations(public, pubKey)
+	return revs == nil || len(revs) > 0
+}
+
+//LookupIdentity find the registration of an identity
+//only registrations proving possession of their key are considered
+//the registry is read at every call, see ReadRegistry to check many blocks
+//identity identity to look for
+//return the registration, nil if the identity is not registered
+func (ledger Ledger) LookupIdentity(identity string) *Registration {
+	registry := ledger.ReadRegistry()
+	if registry == nil {
+		return nil
+	}
+	return registry.Lookup(identity)
+}
+
+//IsRegistered check if a public key is registered
+//only registrations proving possession of their key are considered
+//the registry is read at every call, see ReadRegistry to check many keys
+//pubKey public key to look for
+//return true if some identity is registered with pubKey
+func (ledger Ledger) IsRegistered(pubKey G1) bool {
+	registry := ledger.ReadRegistry()
+	return registry != nil && registry.IsRegistered(pubKey)
+}
+
+//Register record an identity and the public key of a user on the ledger
+//together with the BLS key the user signs blocks with
+//identities and public keys must be unique in the registry, and revoked
+//public keys cannot be registered
+//identity identity to register
+//u user registering, used to prove possession of the private key
+//return true if the registration was written on the ledger
+func (ledger Ledger) Register(identity string, u User) bool {
+	if identity == "" {
+		fmt.Println("Error registering: empty identity")
+		return false
+	}
+	registry := ledger.ReadRegistry()
+	if registry == nil {
+		return false
+	}
+	if registry.Lookup(identity) != nil {
+		fmt.Println("Error registering: identity already registered:", identity)
+		return false
+	}
+	if registry.IsRegistered(u.PublicKey) {
+		fmt.Println("Error registering: public key already registered")
+		return false
+	}
+	if ledger.RevokedOnLedger(u.PublicKey, nil) {
+		fmt.Println("Error registering: public key revoked")
+		return false
+	}
+	reg := Registration{Identity: identity, PublicKey: u.PublicKey, Proof: u.ProvePossession([]byte(identity))}
+	if !AppendRecord(ledger.RegistryFile, encodeRegistration(reg)) {
+		return false
+	}
+	return ledger.RegisterSigner(u)
+}
+
+//RegisterSigner record on the ledger the BLS key a registered user signs
+//blocks with, bound to the public key and the identity of the user by a
+//proof of possession
+//a new signing key replaces the previous one, its entry carries the next
+//counter of the identity
+//u registered user
+//return true if the signing key was written on the ledger
+func (ledger Ledger) RegisterSigner(u User) bool {
+	registry := ledger.ReadRegistry()
+	if registry == nil {
+		return false
+	}
+	current := registry.lookupKey(u.PublicKey)
+	if current == nil {
+		fmt.Println("Error registering signing key: public key not registered")
+		return false
+	}
+	public := u.SigningKey().Public
+	reg := Registration{PublicKey: u.PublicKey, SigningKey: public, SignerCounter: current.SignerCounter + 1}
+	reg.SignerProof = u.ProvePossession(signerMessage(current.Identity, reg.SignerCounter, public))
+	return AppendRecord(ledger.RegistryFile, encodeSigner(reg))
+}
+
+//CheckRegistry check that every registration proves possession of its key
+//and is not a duplicate, and that every signing key is bound to
+//a registered public key
+//return true if the registry is consistent
+func (ledger Ledger) CheckRegistry() bool {
+	registry := ledger.ReadRegistry()
+	return registry != nil && registry.Check()
+}
+
+//keyID encode a public key to be used as map key
+//pubKey public key to encode
+//return the hex encoding of the compressed public key
+func keyID(pubKey G1) string {
+	return hex.EncodeToString(pubKey.Bytes())
+}
+
+//IsRevoked check if the write access of a public key has been revoked
+//pubKey public key to check
+//return true if the public key is in the revocation list of the filekeeper
+//or a revocation signed by the filekeeper is recorded on the ledger
+func (fk *FileKeeper) IsRevoked(pubKey G1) bool {
+	fk.stateMu.RLock()
+	defer fk.stateMu.RUnlock()
+	return fk.isRevoked(pubKey)
+}
+
+//isRevoked check the revocation list and the ledger without taking the lock
+//the ledger is read on every call, so that revocations recorded by another
+//filekeeper, e.g. the revoke command, are seen by a running one
+//pubKey public key to check
+//return true if the public key is revoked or the registry cannot be read
+func (fk *FileKeeper) isRevoked(pubKey G1) bool {
+	if fk.revoked[keyID(pubKey)] {
+		return true
+	}
+	var public []byte
+	if fk.signer != nil {
+		public = fk.signer.Public
+	}
+	return fk.Ledger.RevokedOnLedger(pubKey, public)
+}
+
+//Revoke revoke the write access of a public key
+//the revocation is recorded on the ledger with the current epoch,
+//signed by the filekeeper, and the filekeeper refuses any further token
+//for the public key
+//pubKey public key to revoke
+//return true if the revocation was recorded,
+//false if the filekeeper has no signing key
+func (fk *FileKeeper) Revoke(pubKey G1) bool {
+	fk.stateMu.Lock()
+	defer fk.stateMu.Unlock()
+	if fk.signer == nil {
+		fmt.Println("Revocation refused: signing key not available")
+		return false
+	}
+	if fk.isRevoked(pubKey) {
+		fmt.Println("Public key already revoked")
+		return false
+	}
+	epoch := fk.Ledger.Epoch()
+	if epoch < 0 {
+		return false
+	}
+	rev := Revocation{PublicKey: pubKey, Epoch: epoch}
+	rev.Signature = fk.signer.Sign(rev.signedPart())
+	if !AppendRecord(fk.Ledger.RegistryFile, encodeRevocation(rev)) {
+		return false
+	}
+	fk.revoked[keyID(pubKey)] = true
+	return fk.audit(AuditRevoke, keyFingerprint(pubKey), encodeEpoch(epoch))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistryVerifiedOnRead(t *testing.T) {
+	ledger, _ := newTestLedger(t, 4)
+	alice, bob := GenUser(), GenUser()
+	if !ledger.Register("alice", *alice) {
+		t.Fatal("registration failed")
+	}
+	//a registration of a key without its private key, and a duplicate identity
+	forged := Registration{Identity: "mallory", PublicKey: alice.PublicKey, Proof: bob.ProvePossession([]byte("mallory"))}
+	duplicate := Registration{Identity: "alice", PublicKey: bob.PublicKey, Proof: bob.ProvePossession([]byte("alice"))}
+	for _, reg := range []Registration{forged, duplicate} {
+		if !AppendRecord(ledger.RegistryFile, encodeRegistration(reg)) {
+			t.Fatal("entry not written")
+		}
+	}
+	if ledger.LookupIdentity("mallory") != nil || ledger.IsRegistered(bob.PublicKey) {
+		t.Fatal("invalid registration accepted")
+	}
+	if reg := ledger.LookupIdentity("alice"); reg == nil || !reg.PublicKey.Equals(alice.PublicKey) {
+		t.Fatal("first registration not kept")
+	}
+	if ledger.CheckRegistry() {
+		t.Fatal("invalid registrations not reported")
+	}
+	//the registry read once answers the same queries
+	registry := ledger.ReadRegistry()
+	if registry == nil || registry.Skipped != 2 || len(registry.Registrations) != 1 {
+		t.Fatal("unexpected registry", registry)
+	}
+	if registry.Lookup("mallory") != nil || registry.IsRegistered(bob.PublicKey) || !registry.IsRegistered(alice.PublicKey) {
+		t.Fatal("invalid registration accepted")
+	}
+}
+
+func TestRevocationsSigned(t *testing.T) {
+	ledger, fk := newTestLedger(t, 4)
+	alice, bob := GenUser(), GenUser()
+	if fk.Revoke(alice.PublicKey) {
+		t.Fatal("revocation without signing key recorded")
+	}
+	key := GenSigningKey()
+	if !fk.SetSigner(key) || !fk.Revoke(alice.PublicKey) {
+		t.Fatal("revocation failed")
+	}
+	//a writer appends an unsigned revocation and one signed with its own key
+	forged := Revocation{PublicKey: bob.PublicKey, Epoch: 0}
+	unsigned := encodeRevocation(forged)
+	forged.Signature = GenSigningKey().Sign(forged.signedPart())
+	for _, entry := range [][]byte{unsigned, encodeRevocation(forged)} {
+		if !AppendRecord(ledger.RegistryFile, entry) {
+			t.Fatal("entry not written")
+		}
+	}
+	next := NewFileKeeper(ledger, nil)
+	if !next.SetSigner(key) {
+		t.Fatal("signing key not set")
+	}
+	if !next.IsRevoked(alice.PublicKey) || next.IsRevoked(bob.PublicKey) {
+		t.Fatal("revocations not verified on load")
+	}
+	if revs := ledger.Revocations(key.Public); len(revs) != 1 || !revs[0].PublicKey.Equals(alice.PublicKey) {
+		t.Fatal("unexpected revocations", revs)
+	}
+}
+
+func TestSignerVerifiedOnRead(t *testing.T) {
+	ledger, _ := newTestLedger(t, 4)
+	alice, bob := GenUser(), GenUser()
+	if !ledger.Register("alice", *alice) {
+		t.Fatal("registration failed")
+	}
+	//a signing key attached to the public key of alice without her proof
+	public := bob.SigningKey().Public
+	forged := Registration{PublicKey: alice.PublicKey, SigningKey: public, SignerProof: bob.ProvePossession(public)}
+	if !AppendRecord(ledger.RegistryFile, encodeSigner(forged)) {
+		t.Fatal("entry not written")
+	}
+	if reg := ledger.LookupIdentity("alice"); reg == nil || !bytes.Equal(reg.SigningKey, alice.SigningKey().Public) {
+		t.Fatal("forged signing key attached")
+	}
+	if ledger.CheckRegistry() || ledger.CheckConsistency(-1, nil) {
+		t.Fatal("invalid signing key not reported")
+	}
+}
+
+func TestUnsignedBlockOfSigner(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	alice := GenUser()
+	if !ledger.Register("alice", *alice) {
+		t.Fatal("registration failed")
+	}
+	token := fk.TokenGen(alice.PublicKey)
+	opts := BlockOptions{Author: IdentityAuthor("alice"), Sign: true}
+	if alice.AddBlockWith(ledger, token, newTestFile(t, 100), opts) < 0 || !ledger.CheckConsistency(-1, nil) {
+		t.Fatal("signed block rejected")
+	}
+	//alice has a registered signing key, her blocks must be signed
+	opts.Sign = false
+	if alice.AddBlockWith(ledger, token, newTestFile(t, 100), opts) < 0 {
+		t.Fatal("block not added")
+	}
+	if ledger.CheckConsistency(-1, nil) {
+		t.Fatal("unsigned block of a signer accepted")
+	}
+}
+
+func TestRevocationsOnLedger(t *testing.T) {
+	ledger, fk := newTestLedger(t, 4)
+	alice, bob := GenUser(), GenUser()
+	key := GenSigningKey()
+	//a running filekeeper without signing key
+	if fk.TokenGen(alice.PublicKey) == nil {
+		t.Fatal("token refused")
+	}
+	//alice is revoked by another filekeeper, e.g. the revoke command
+	revoker := NewFileKeeper(ledger, nil)
+	if !revoker.SetSigner(key) || !revoker.Revoke(alice.PublicKey) {
+		t.Fatal("revocation failed")
+	}
+	if fk.TokenGen(alice.PublicKey) != nil || fk.TokenGen(bob.PublicKey) == nil {
+		t.Fatal("revocation on the ledger not checked")
+	}
+	if ledger.Register("alice2", *alice) || !ledger.Register("bob", *bob) {
+		t.Fatal("registration of a revoked key accepted")
+	}
+	//a pinned key is preferred to the recorded one
+	pinned := ledger
+	pinned.FileKeeperKey = GenSigningKey().Public
+	if pinned.RevokedOnLedger(alice.PublicKey, nil) || !ledger.RevokedOnLedger(alice.PublicKey, nil) {
+		t.Fatal("revocation not verified with the pinned key")
+	}
+}
+
+func TestSignerReplay(t *testing.T) {
+	ledger, _ := newTestLedger(t, 4)
+	alice := GenUser()
+	if !ledger.Register("alice", *alice) {
+		t.Fatal("registration failed")
+	}
+	records := ReadRecords(ledger.RegistryFile)
+	first := records[len(records)-1]
+	//alice replaces her signing key
+	public := GenSigningKey().Public
+	next := Registration{PublicKey: alice.PublicKey, SigningKey: public, SignerCounter: 2}
+	next.SignerProof = alice.ProvePossession(signerMessage("alice", 2, public))
+	if !AppendRecord(ledger.RegistryFile, encodeSigner(next)) {
+		t.Fatal("entry not written")
+	}
+	if reg := ledger.LookupIdentity("alice"); reg == nil || !bytes.Equal(reg.SigningKey, public) || !ledger.CheckRegistry() {
+		t.Fatal("new signing key not attached")
+	}
+	//the first entry is replayed, and a newer one is bound to another identity
+	other := Registration{PublicKey: alice.PublicKey, SigningKey: alice.SigningKey().Public, SignerCounter: 3}
+	other.SignerProof = alice.ProvePossession(signerMessage("mallory", 3, other.SigningKey))
+	for _, entry := range [][]byte{first, encodeSigner(other)} {
+		if !AppendRecord(ledger.RegistryFile, entry) {
+			t.Fatal("entry not written")
+		}
+	}
+	if reg := ledger.LookupIdentity("alice"); reg == nil || !bytes.Equal(reg.SigningKey, public) || reg.SignerCounter != 2 {
+		t.Fatal("signing key rolled back")
+	}
+	if ledger.CheckRegistry() {
+		t.Fatal("replayed entries not reported")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+//Wipe overwrite secret bytes with zeros once they are no longer needed
+//pads, private keys and encodings of secret scalars are wiped by the
+//functions that create them, unless they are returned to the caller;
+//copies made by the runtime, e.g. when a slice grows, cannot be wiped
+//secret slice to overwrite
+func Wipe(secret []byte) {
+	for i := range secret {
+		secret[i] = 0
+	}
+}
+
+//WipeScalars overwrite secret scalars with zero
+//nil scalars are skipped
+//scalars scalars to overwrite
+func WipeScalars(scalars ...Scalar) {
+	for _, s := range scalars {
+		if s != nil {
+			s.Wipe()
+		}
+	}
+}
+
+//Destroy wipe the private keys of the user
+//the user cannot unlock, encapsulate or share keys anymore
+func (u *User) Destroy() {
+	WipeScalars(u.mu, u.v)
+	u.mu, u.v = nil, nil
+}
+
+//Destroy wipe the time-key and the signing key of the filekeeper
+//the filekeeper refuses tokens and cannot update the ledger anymore
+func (fk *FileKeeper) Destroy() {
+	fk.stateMu.Lock()
+	defer fk.stateMu.Unlock()
+	WipeScalars(fk.s)
+	fk.s = nil
+	fk.auditMu.Lock()
+	defer fk.auditMu.Unlock()
+	if fk.signer != nil {
+		fk.signer.Destroy()
+		fk.signer = nil
+	}
+}
+
+//Destroy wipe the secret key of a BLS key pair
+//the key pair cannot sign anymore
+func (key *SigningKey) Destroy() {
+	Wipe(key.secret)
+}
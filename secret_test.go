@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWipeAfterUse(t *testing.T) {
+	ledger, fk := newTestLedger(t, 4)
+	u := GenUser()
+	index := u.AddBlock(ledger, fk.TokenGen(u.PublicKey), newTestFile(t, 200))
+	//wiping the intermediate values leaves the operands unchanged
+	keyEnc := ledger.GetEncKey(index)
+	encoded := keyEnc.Bytes()
+	unlocked := u.UnlockKey(keyEnc)
+	if !bytes.Equal(keyEnc.Bytes(), encoded) || !u.EncapsulateKey(unlocked).Equals(keyEnc) {
+		t.Fatal("FracMult changed its operands")
+	}
+	ledger.DecryptBlock(index, unlocked, newTestFile(t, 0))
+	unlocked.Wipe()
+	if !unlocked.IsIdentity() {
+		t.Fatal("unlocked key not wiped")
+	}
+	//the previous time-key is wiped by the update
+	old := fk.s
+	fk.Update()
+	if !bytes.Equal(old.Bytes(), make([]byte, Group.ScalarLen())) {
+		t.Fatal("previous time-key not wiped")
+	}
+	mu := u.mu
+	u.Destroy()
+	if u.mu != nil || !bytes.Equal(mu.Bytes(), make([]byte, Group.ScalarLen())) {
+		t.Fatal("private keys not wiped")
+	}
+	if u.UnlockKey(keyEnc) != nil || u.EncapsulateKey(keyEnc) != nil {
+		t.Fatal("keys used after the user was destroyed")
+	}
+	fk.Destroy()
+	if fk.TokenGen(GenUser().PublicKey) != nil {
+		t.Fatal("token issued after the filekeeper was destroyed")
+	}
+	if fk.Update() != nil || ledger.Epoch() != 1 {
+		t.Fatal("ledger updated after the filekeeper was destroyed")
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+//LockSuffix suffix of the writer lock file, next to the key-file
+const LockSuffix = ".lock"
+
+//Lock take the writer lock of the ledger
+//every change of the key-file and of the blocks is done holding the lock,
+//so that concurrent writers get unique indices and a correct hash chain;
+//the lock is not reentrant
+//path to the key-file taken from Ledger struct
+//return a function that releases the lock, nil on failure
+func (ledger Ledger) Lock() func() {
+	file := acquireLock(ledger.KeysFile + LockSuffix)
+	if file == nil {
+		return nil
+	}
+	return func() {
+		releaseLock(file)
+	}
+}
+
+//tempCiphertextName generate a unique name for a ciphertext being written
+//the ciphertext is renamed once its index is known
+//path to the ciphertexts taken from Ledger struct
+//return the temporary path
+func (ledger Ledger) tempCiphertextName() string {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		fmt.Println("Error generating file name:", err)
+		panic(err)
+	}
+	return ledger.EncryptPath + "tmp-" + hex.EncodeToString(random) + ".enc"
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+//newTestLedger create an initialised ledger in a temporary folder
+//the ledger uses the insecure test group, see testGroup
+//shards number of masking shards
+//return the ledger and its filekeeper
+func newTestLedger(t testing.TB, shards int) (Ledger, *FileKeeper) {
+	return newTestLedgerFrom(t, testGroup{}, shards, nil)
+}
+
+//newTestLedgerFrom create an initialised ledger reading from a source of randomness
+//the source is shared by the ledger and its filekeeper
+//group pairing group of the ledger
+//shards number of masking shards
+//rng source of randomness, nil to use crypto/rand
+//return the ledger and its filekeeper
+func newTestLedgerFrom(t testing.TB, group PairingGroup, shards int, rng io.Reader) (Ledger, *FileKeeper) {
+	dir := t.TempDir()
+	Group = group
+	PadSize = 96
+	MaxShards = shards
+	ledger := Ledger{
+		ShardsFile:   filepath.Join(dir, "shards.enc"),
+		KeysFile:     filepath.Join(dir, "keys.enc"),
+		RootPath:     filepath.Join(dir, "block"),
+		EncryptPath:  filepath.Join(dir, "ct"),
+		RegistryFile: filepath.Join(dir, "registry.enc"),
+		ParamsFile:   filepath.Join(dir, "params.txt"),
+		AuditFile:    filepath.Join(dir, "audit.log"),
+		Rand:         rng,
+	}
+	fk := NewFileKeeper(ledger, ledger.Init())
+	fk.Rand = rng
+	return ledger, fk
+}
+
+//newTestFile write a random file in a temporary folder
+//size size of the file
+//return the path of the file
+func newTestFile(t testing.TB, size int) string {
+	content := make([]byte, size)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "plaintext")
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	const writers, rounds = 8, 4
+	//the files are written before the writers start, t.Fatal
+	//must not be called from their goroutines
+	files := make([][]string, rounds)
+	for r := range files {
+		if r%2 == 0 {
+			files[r] = []string{newTestFile(t, 50+100*r)}
+		} else {
+			files[r] = []string{newTestFile(t, 10), newTestFile(t, 500)}
+		}
+	}
+	users := make([]*User, writers)
+	var wg sync.WaitGroup
+	for w := range users {
+		users[w] = GenUser()
+		wg.Add(1)
+		go func(u *User) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				token := fk.TokenGen(u.PublicKey)
+				if r%2 == 0 {
+					if u.AddBlock(ledger, token, files[r][0]) < 0 {
+						t.Error("block not added")
+					}
+				} else if u.AddBlocks(ledger, token, files[r], BlockOptions{}) == nil {
+					t.Error("batch not added")
+				}
+			}
+		}(users[w])
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+	//every index is assigned to exactly one writer
+	total := int64(writers * (rounds + rounds/2))
+	if n := ledger.NumKeys(); n != total {
+		t.Fatalf("%d keys, expected %d", n, total)
+	}
+	owners := make(map[int64]int)
+	for w, u := range users {
+		for _, i := range u.Blocks {
+			if _, ok := owners[i]; ok {
+				t.Fatalf("index %d assigned twice", i)
+			}
+			owners[i] = w
+		}
+	}
+	if int64(len(owners)) != total {
+		t.Fatalf("%d indices assigned, expected %d", len(owners), total)
+	}
+	//the hash chain and the control shards are correct
+	if !ledger.CheckConsistency(-1, nil) {
+		t.Fatal("ledger not consistent")
+	}
+	//every block decrypts under the key of its owner
+	fk.Update()
+	for i := int64(0); i < total; i++ {
+		u := users[owners[i]]
+		out := filepath.Join(t.TempDir(), "decrypted")
+		unlocked := u.UnlockKey(ledger.GetEncKey(i))
+		ledger.DecryptBlock(i, unlocked, out)
+		if !bytes.Equal(ledger.PlaintextDigest(i, unlocked, out), ledger.GetBlock(i).PtDigest) {
+			t.Fatalf("block %d not decrypted", i)
+		}
+	}
+}
+
+func TestWritersDuringUpdates(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	fileName := newTestFile(t, 300)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u := GenUser()
+			for r := 0; r < 4; r++ {
+				//blocks overlapping an update are refused, not corrupted
+				u.AddBlock(ledger, fk.TokenGen(u.PublicKey), fileName)
+			}
+		}()
+	}
+	for r := 0; r < 3; r++ {
+		if fk.Update() == nil {
+			t.Fatal("update failed")
+		}
+	}
+	wg.Wait()
+	if !ledger.CheckConsistency(-1, nil) {
+		t.Fatal("ledger not consistent")
+	}
+}
+
+func TestAddBlocksRollback(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	u := GenUser()
+	token := fk.TokenGen(u.PublicKey)
+	if u.AddBlock(ledger, token, newTestFile(t, 100)) != 0 {
+		t.Fatal("block not added")
+	}
+	keys, err := ioutil.ReadFile(ledger.KeysFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the block of the second file of the batch cannot be written
+	if err := os.Mkdir(ledger.BlockName(2), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{newTestFile(t, 200), newTestFile(t, 300), newTestFile(t, 400)}
+	if u.AddBlocks(ledger, token, files, BlockOptions{}) != nil {
+		t.Fatal("partially written batch reported as successful")
+	}
+	//keys, blocks and ciphertexts are restored
+	after, err := ioutil.ReadFile(ledger.KeysFile)
+	if err != nil || !bytes.Equal(keys, after) {
+		t.Fatal("keys not restored")
+	}
+	if _, err := os.Stat(ledger.BlockName(1)); !os.IsNotExist(err) {
+		t.Fatal("block of the batch not removed")
+	}
+	if written, _ := filepath.Glob(ledger.EncryptPath + "*"); len(written) != 3 {
+		t.Fatal("ciphertexts of the batch not removed:", written)
+	}
+	if len(u.Blocks) != 1 || !ledger.CheckConsistency(-1, nil) {
+		t.Fatal("ledger not consistent after the rollback")
+	}
+	//the ledger is usable after the rollback
+	if err := os.Remove(ledger.BlockName(2)); err != nil {
+		t.Fatal(err)
+	}
+	if indices := u.AddBlocks(ledger, token, files, BlockOptions{}); len(indices) != 3 || indices[0] != 1 {
+		t.Fatal("batch not added after the rollback")
+	}
+	if fk.Update() == nil || !ledger.CheckConsistency(-1, nil) {
+		t.Fatal("ledger not consistent after the update")
+	}
+	//the keys and shards are rewritten through temporary files
+	if temps, _ := filepath.Glob(filepath.Join(filepath.Dir(ledger.KeysFile), "*.tmp-*")); len(temps) > 0 {
+		t.Fatal("temporary files left:", temps)
+	}
+}
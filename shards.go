@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//ParamShards name of the parameter with the history of the number of shards
+const ParamShards = "shards"
+
+//ShardSegment number of masking shards in use from a key index on
+//blocks added with index at least From use the control shard
+//index % Shards, until the next segment
+type ShardSegment struct {
+	From   int64
+	Shards int
+}
+
+//encodeShardSegments encode the history of the number of shards
+//segments segments in increasing order of first key index
+//return the parameter value, "from:shards" pairs separated by commas
+func encodeShardSegments(segments []ShardSegment) string {
+	encoded := make([]string, len(segments))
+	for i, segment := range segments {
+		encoded[i] = strconv.FormatInt(segment.From, 10) + ":" + strconv.Itoa(segment.Shards)
+	}
+	return strings.Join(encoded, ",")
+}
+
+//decodeShardSegments decode the history of the number of shards
+//encoded parameter value
+//return the segments, nil if malformed
+func decodeShardSegments(encoded string) []ShardSegment {
+	var segments []ShardSegment
+	for _, pair := range strings.Split(encoded, ",") {
+		fields := strings.Split(pair, ":")
+		if len(fields) != 2 {
+			fmt.Println("Invalid shards parameter:", encoded)
+			return nil
+		}
+		from, err1 := strconv.ParseInt(fields[0], 10, 64)
+		shards, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil || shards < 1 {
+			fmt.Println("Invalid shards parameter:", encoded)
+			return nil
+		}
+		//segments are ordered and the number of shards only grows
+		if n := len(segments); n > 0 && (from < segments[n-1].From || shards < segments[n-1].Shards) {
+			fmt.Println("Invalid shards parameter:", encoded)
+			return nil
+		}
+		segments = append(segments, ShardSegment{from, shards})
+	}
+	return segments
+}
+
+//ShardSegments read the history of the number of shards
+//ledgers without the parameter use MaxShards for every block
+//return the segments in increasing order of first key index, nil on failure
+func (ledger Ledger) ShardSegments() []ShardSegment {
+	params := ledger.ReadParams()
+	if params == nil {
+		return nil
+	}
+	encoded, ok := params[ParamShards]
+	if !ok {
+		return []ShardSegment{{0, MaxShards}}
+	}
+	return decodeShardSegments(encoded)
+}
+
+//NumShards read the current number of masking shards
+//return the number of shards, -1 on failure
+func (ledger Ledger) NumShards() int {
+	segments := ledger.ShardSegments()
+	if segments == nil {
+		return -1
+	}
+	return segments[len(segments)-1].Shards
+}
+
+//controlIndex compute the index of the control shard of a block
+//segments history of the number of shards
+//index index of the block
+//return the index of the masking shard
+func controlIndex(segments []ShardSegment, index int64) int64 {
+	shards := segments[0].Shards
+	for _, segment := range segments {
+		if segment.From > index {
+			break
+		}
+		shards = segment.Shards
+	}
+	return index % int64(shards)
+}
+
+//controlShard get the control shard of a block
+//segments history of the number of shards
+//index index of the block
+//return the masking shard, nil on failure
+func (ledger Ledger) controlShard(segments []ShardSegment, index int64) G2 {
+	return ledger.Shard(controlIndex(segments, index))
+}
+
+//ExtendShards append new masking shards to the ledger
+//the shards are generated under the current time-key, and are updated
+//like the others; blocks already added keep their control shard, new blocks
+//use the control shard index % (old + n)
+//n number of shards to add
+//return true if the shards were added
+func (fk *FileKeeper) ExtendShards(n int) bool {
+	if n < 1 {
+		fmt.Println("Error extending shards: non-positive number of shards")
+		return false
+	}
+	ledger := fk.Ledger
+	unlock := ledger.Lock()
+	if unlock == nil {
+		return false
+	}
+	defer unlock()
+	fk.stateMu.Lock()
+	defer fk.stateMu.Unlock()
+	if fk.s == nil {
+		fmt.Println("Error extending shards: time-key not available")
+		return false
+	}
+	segments := ledger.ShardSegments()
+	numKeys := ledger.NumKeys()
+	if segments == nil || numKeys < 0 {
+		return false
+	}
+	old := segments[len(segments)-1].Shards
+	//check that the shards file contains exactly the shards in use
+	size := int64(Group.G2Len())
+	fi, err := os.Stat(ledger.ShardsFile)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	if fi.Size() != int64(old)*size {
+		fmt.Println("Error extending shards: shards file does not contain", old, "shards")
+		return false
+	}
+	//generate the new shards
+	encoded := make([]byte, int64(n)*size)
+	for i := int64(0); i < int64(n); i++ {
+		r := GenExpFrom(fk.Rand)
+		eps := Group.G2Generator().Mul(r).Mul(fk.s)
+		r.Wipe()
+		copy(encoded[i*size:], eps.Bytes())
+	}
+	//record the new number of shards, a block added at numKeys uses it
+	if last := &segments[len(segments)-1]; last.From == numKeys {
+		last.Shards = old + n
+	} else {
+		segments = append(segments, ShardSegment{numKeys, old + n})
+	}
+	file, err := os.OpenFile(ledger.ShardsFile, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	_, err = file.Write(encoded)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || !ledger.SetParam(ParamShards, encodeShardSegments(segments)) {
+		fmt.Println("Error extending shards:", err)
+		//remove the shards not recorded in the parameters
+		if err := os.Truncate(ledger.ShardsFile, fi.Size()); err != nil {
+			panic("Error rolling back shards!")
+		}
+		return false
+	}
+	if !fk.audit(AuditExtend, encodeEpoch(int64(old)), encodeEpoch(int64(old+n)), encodeEpoch(numKeys)) {
+		return false
+	}
+	//sign the new state of the shards file
+	return fk.signer == nil || fk.Checkpoint()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+//shardCache decoded masking shards of a shards file
+//the shards change at every update, so the cache is valid only for the
+//epoch and the version of the shards file it was filled in; generation
+//counts the times the cache was emptied, shards read before are not stored
+type shardCache struct {
+	mu         sync.Mutex
+	epoch      int64
+	modTime    time.Time
+	size       int64
+	generation uint64
+	shards     map[int64]G2
+}
+
+//shardCaches caches of the shards files in use, by path
+var shardCaches = struct {
+	sync.Mutex
+	byPath map[string]*shardCache
+}{byPath: make(map[string]*shardCache)}
+
+//shardStore get the cache of the masking shards of the ledger
+//the cache is emptied if the ledger has been updated since it was filled
+//path to the shards file taken from Ledger struct
+//return the cache, nil if the shards file cannot be read
+func (ledger Ledger) shardStore() *shardCache {
+	fi, err := os.Stat(ledger.ShardsFile)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	epoch := ledger.Epoch()
+	shardCaches.Lock()
+	cache, ok := shardCaches.byPath[ledger.ShardsFile]
+	if !ok {
+		cache = &shardCache{}
+		shardCaches.byPath[ledger.ShardsFile] = cache
+	}
+	shardCaches.Unlock()
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.shards == nil || cache.epoch != epoch || !cache.modTime.Equal(fi.ModTime()) || cache.size != fi.Size() {
+		cache.epoch = epoch
+		cache.modTime = fi.ModTime()
+		cache.size = fi.Size()
+		cache.generation++
+		cache.shards = make(map[int64]G2)
+	}
+	return cache
+}
+
+//get read a single masking shard, decoding it only once
+//ledger struct with file paths of the ledger
+//index index of the masking shard
+//return the masking shard, nil on failure
+func (cache *shardCache) get(ledger Ledger, index int64) G2 {
+	cache.mu.Lock()
+	eps, ok := cache.shards[index]
+	generation := cache.generation
+	cache.mu.Unlock()
+	if ok {
+		return eps
+	}
+	encoded := ReadValue(ledger.ShardsFile, index, int64(Group.G2Len()))
+	if encoded == nil {
+		return nil
+	}
+	//invalid shards are not cached
+	if eps = Group.G2FromBytes(encoded); eps == nil {
+		fmt.Println("Invalid masking shard", index)
+		return nil
+	}
+	//the cache may have been emptied for a new epoch while reading
+	cache.mu.Lock()
+	if cache.generation == generation {
+		cache.shards[index] = eps
+	}
+	cache.mu.Unlock()
+	return eps
+}
+
+//Shard read a single masking shard through the cache of the ledger
+//index index of the masking shard
+//return the masking shard, nil on failure
+func (ledger Ledger) Shard(index int64) G2 {
+	cache := ledger.shardStore()
+	if cache == nil {
+		return nil
+	}
+	return cache.get(ledger, index)
+}
+
+//ShardRange read the first masking shards through the cache of the ledger
+//the range is read with a single read, and only the shards not cached
+//are decoded, concurrently
+//numShards number of shards to read
+//return slice containing the masking shards, nil on failure
+func (ledger Ledger) ShardRange(numShards int) []G2 {
+	cache := ledger.shardStore()
+	if cache == nil {
+		return nil
+	}
+	shards := make([]G2, numShards)
+	var missing []int
+	cache.mu.Lock()
+	generation := cache.generation
+	for i := range shards {
+		if eps, ok := cache.shards[int64(i)]; ok {
+			shards[i] = eps
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	cache.mu.Unlock()
+	if len(missing) == 0 {
+		return shards
+	}
+	size := Group.G2Len()
+	encoded := ReadValue(ledger.ShardsFile, 0, int64(numShards*size))
+	if encoded == nil {
+		return nil
+	}
+	var wg sync.WaitGroup
+	for _, i := range missing {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			shards[i] = Group.G2FromBytes(encoded[i*size : (i+1)*size])
+		}(i)
+	}
+	wg.Wait()
+	for _, i := range missing {
+		if shards[i] == nil {
+			fmt.Println("Invalid masking shard", i)
+			return nil
+		}
+	}
+	cache.mu.Lock()
+	if cache.generation == generation {
+		for _, i := range missing {
+			cache.shards[int64(i)] = shards[i]
+		}
+	}
+	cache.mu.Unlock()
+	return shards
+}
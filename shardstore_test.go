@@ -0,0 +1,96 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestShardCacheUpdate(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	for _, i := range []int64{0, 5, 15} {
+		if !ledger.Shard(i).Equals(ledger.GetSingleShard(i)) {
+			t.Fatal("cached shard differs from the shards file")
+		}
+	}
+	before := ledger.ShardRange(4)
+	fk.Update()
+	after := ledger.ShardRange(4)
+	for i := range after {
+		if after[i].Equals(before[i]) {
+			t.Fatal("cache not invalidated by the update")
+		}
+		if !after[i].Equals(ledger.GetSingleShard(int64(i))) {
+			t.Fatal("cached shard differs from the shards file")
+		}
+	}
+}
+
+//benchmarkDecrypt decrypt a small file on a ledger with many shards
+//cached whether the shard cache is kept between decryptions
+func benchmarkDecrypt(b *testing.B, cached bool) {
+	ledger, fk := newTestLedger(b, 1024)
+	u := GenUser()
+	index := u.AddBlock(ledger, fk.TokenGen(u.PublicKey), newTestFile(b, 1024))
+	unlocked := u.UnlockKey(ledger.GetEncKey(index))
+	out := filepath.Join(b.TempDir(), "decrypted")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !cached {
+			shardCaches.Lock()
+			delete(shardCaches.byPath, ledger.ShardsFile)
+			shardCaches.Unlock()
+		}
+		ledger.DecryptBlock(index, unlocked, out)
+	}
+}
+
+func BenchmarkDecryptSmallFile(b *testing.B) {
+	benchmarkDecrypt(b, false)
+}
+
+func BenchmarkDecryptSmallFileCached(b *testing.B) {
+	benchmarkDecrypt(b, true)
+}
+
+func BenchmarkGetShardsAll(b *testing.B) {
+	ledger, _ := newTestLedger(b, 1024)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ledger.GetShards(MaxShards)
+	}
+}
+
+func TestShardCacheConcurrentUpdate(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					ledger.ShardRange(16)
+					ledger.Shard(3)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if fk.Update() == nil {
+			t.Fatal("update failed")
+		}
+	}
+	close(done)
+	wg.Wait()
+	//shards read during an update are not cached for the new epoch
+	for i := int64(0); i < 16; i++ {
+		if !ledger.Shard(i).Equals(ledger.GetSingleShard(i)) {
+			t.Fatal("cached shard differs from the shards file")
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+//parts of a shared key
+//a shared key is an ElGamal encryption (t*G, key + t*pk) of the block key
+//under the public key pk of the recipient, G generator of G1, stored as two consecutive
+//encapsulated keys; both points are updated by the filekeeper like any other
+//encapsulated key, so the recipient always recovers the current block key
+const (
+	//ShareEphemeral first part of the shared key: t*G
+	ShareEphemeral byte = 0
+	//ShareMasked second part of the shared key: key + t*pk
+	ShareMasked byte = 1
+)
+
+//encodeShare encode the share field of a block
+//origin index of the shared block
+//part part of the shared key the block refers to
+//return the encoded field
+func encodeShare(origin int64, part byte) []byte {
+	encoded := make([]byte, 9)
+	binary.BigEndian.PutUint64(encoded, uint64(origin))
+	encoded[8] = part
+	return encoded
+}
+
+//ShareOf decode the share field of a block
+//return the index of the shared block and the part of the shared key,
+//-1 if the block is not a share
+func (block Block) ShareOf() (int64, byte) {
+	encoded, ok := block.Fields[FieldShare]
+	if !ok || len(encoded) != 9 {
+		return -1, 0
+	}
+	return int64(binary.BigEndian.Uint64(encoded)), encoded[8]
+}
+
+//CiphertextIndex compute the index of the ciphertext a block refers to
+//index index of the block
+//return index for ordinary blocks, the index of the shared block for shares
+func (block Block) CiphertextIndex(index int64) int64 {
+	if origin, _ := block.ShareOf(); origin >= 0 {
+		return origin
+	}
+	return index
+}
+
+//ShareBlock share a block with another user
+//the owner unlocks the block key and encrypts it for the recipient,
+//appending the two parts of the shared key and their blocks to the ledger
+//ledger struct with file paths of the ledger
+//index index of the block to share, owned by u, or the first part of
+//a shared key whose recipient is u
+//recipient public key of the recipient
+//return the index of the first part of the shared key, -1 on failure
+func (u User) ShareBlock(ledger Ledger, index int64, recipient G1) int64 {
+	block := ledger.GetBlock(index)
+	if block == nil {
+		return -1
+	}
+	if _, part := block.ShareOf(); part == ShareMasked {
+		fmt.Println("Error sharing: block", index, "is the second part of a shared key")
+		return -1
+	}
+	//shares of shares refer directly to the original ciphertext
+	origin := block.CiphertextIndex(index)
+	//recover the current block key, a share is unlocked by its recipient
+	var key G1
+	if shared, _ := block.ShareOf(); shared >= 0 {
+		ephemeral, masked := ledger.GetSharedKey(index)
+		if ephemeral == nil || masked == nil {
+			return -1
+		}
+		key = u.UnlockShared(ephemeral, masked)
+	} else {
+		keyEnc := ledger.GetEncKey(index)
+		if keyEnc == nil {
+			return -1
+		}
+		key = u.UnlockKey(keyEnc)
+	}
+	if key == nil {
+		return -1
+	}
+	//encrypt it under the public key of the recipient
+	t := GenExpFrom(u.Rand)
+	ephemeral := Group.G1Generator().Mul(t)
+	tpk := recipient.Mul(t)
+	masked := tpk.Add(key)
+	t.Wipe()
+	tpk.Wipe()
+	key.Wipe()
+	//save both parts on the ledger holding the writer lock
+	unlock := ledger.Lock()
+	if unlock == nil {
+		return -1
+	}
+	defer unlock()
+	segments := ledger.ShardSegments()
+	if segments == nil {
+		return -1
+	}
+	numKeys := ledger.NumKeys()
+	if numKeys < 0 {
+		return -1
+	}
+	//remove the keys and blocks written, keys without their blocks would
+	//break the chain of the next writer
+	rollback := func() int64 {
+		os.Remove(ledger.BlockName(numKeys))
+		os.Remove(ledger.BlockName(numKeys + 1))
+		if !ledger.truncateKeys(numKeys) {
+			panic("Error rolling back encapsulated keys!")
+		}
+		fmt.Println("Share of block", index, "rolled back")
+		return -1
+	}
+	keyIndex := ledger.AppendEncapsulatedKeys([]G1{ephemeral, masked})
+	if keyIndex != numKeys {
+		return rollback()
+	}
+	for part, keyEnc := range []G1{ephemeral, masked} {
+		i := keyIndex + int64(part)
+		share := Block{Fields: make(map[byte][]byte)}
+		share.Prev = FileDigest(ledger.BlockName(i - 1))
+		//same ciphertext and plaintext of the shared block
+		share.CtDigest = block.CtDigest
+		share.PtDigest = block.PtDigest
+		share.Control = HashAte(ledger.controlShard(segments, i), keyEnc)
+		share.Fields[FieldShare] = encodeShare(origin, byte(part))
+		//shredding the shared block shreds the share too, shares expire with
+		//the shared block and describe the same plaintext
+		for _, tag := range []byte{FieldShred, FieldExpiry, FieldChunks, FieldCompression, FieldMetadata, FieldCommitment, FieldAlgorithms} {
+			if value, ok := block.Fields[tag]; ok {
+				share.Fields[tag] = value
+			}
+		}
+		if !ledger.WriteBlock(i, share) {
+			return rollback()
+		}
+	}
+	return keyIndex
+}
+
+//GetSharedKey read from file the two parts of a shared key
+//index index of the first part of the shared key
+//return the two parts of the shared key, nil if they cannot be read
+func (ledger Ledger) GetSharedKey(index int64) (G1, G1) {
+	return ledger.GetEncKey(index), ledger.GetEncKey(index + 1)
+}
+
+//UnlockShared unlock a key shared with the user for decryption
+//ephemeral first part of the shared key
+//masked second part of the shared key
+//private key mu is taken from User struct u
+//return unlocked key, nil if the private keys have been destroyed
+func (u User) UnlockShared(ephemeral, masked G1) G1 {
+	if u.mu == nil {
+		fmt.Println("Error unlocking key: private keys not available")
+		return nil
+	}
+	tpk := ephemeral.Mul(u.mu)
+	defer tpk.Wipe()
+	return masked.Sub(tpk)
+}
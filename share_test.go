@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReshare(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	alice, bob, carol := GenUser(), GenUser(), GenUser()
+	index := alice.AddBlock(ledger, fk.TokenGen(alice.PublicKey), newTestFile(t, 500))
+	//the recipient of a share shares it again
+	toBob := alice.ShareBlock(ledger, index, bob.PublicKey)
+	toCarol := bob.ShareBlock(ledger, toBob, carol.PublicKey)
+	if toBob < 0 || toCarol < 0 {
+		t.Fatal("block not shared")
+	}
+	fk.Update()
+	unlocked := carol.UnlockShared(ledger.GetSharedKey(toCarol))
+	out := filepath.Join(t.TempDir(), "decrypted")
+	ledger.DecryptBlock(toCarol, unlocked, out)
+	if !bytes.Equal(ledger.PlaintextDigest(toCarol, unlocked, out), ledger.GetBlock(index).PtDigest) {
+		t.Fatal("share of a share not decrypted")
+	}
+}
+
+func TestShareRollback(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	alice, bob := GenUser(), GenUser()
+	index := alice.AddBlock(ledger, fk.TokenGen(alice.PublicKey), newTestFile(t, 500))
+	if index < 0 {
+		t.Fatal("block not added")
+	}
+	//the block of the second part of the share cannot be written
+	if err := os.Mkdir(ledger.BlockName(index+2), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if alice.ShareBlock(ledger, index, bob.PublicKey) >= 0 {
+		t.Fatal("share without its blocks reported as successful")
+	}
+	if ledger.NumKeys() != index+1 || !ledger.CheckConsistency(-1, nil) {
+		t.Fatal("share not rolled back")
+	}
+	//the ledger is usable after the rollback
+	if alice.ShareBlock(ledger, index, bob.PublicKey) != index+1 || !ledger.CheckConsistency(-1, nil) {
+		t.Fatal("block not shared after the rollback")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+//kinds of tombstones
+//a tombstone replaces an encapsulated key in the key-file, it has the same
+//size and its first byte is never the first byte of an encoded G1 element
+const (
+	//TombstoneShred key shredded on request of the owner,
+	//followed by the secret that proves ownership of the block
+	TombstoneShred byte = 0x00
+	//TombstoneExpired key removed by the filekeeper after its expiry,
+	//followed by the epoch in which it has been removed
+	TombstoneExpired byte = 0x01
+)
+
+//IsTombstone check if a record of the key-file is a tombstone
+//record encoding read from the key-file
+//return true if the record is not an encapsulated key
+func IsTombstone(record []byte) bool {
+	return len(record) > 0 && record[0] != 0x02 && record[0] != 0x03
+}
+
+//ShredProof compute the secret that proves ownership of a block
+//the block stores the digest of this secret, revealing it allows the
+//filekeeper to shred the block
+//index index of the block
+//private key v is taken from User struct u
+//return the secret
+func (u User) ShredProof(index int64) []byte {
+	encoded := append([]byte("shred"), u.v.Bytes()...)
+	encoded = append(encoded, encodeEpoch(index)...)
+	h := Hash(encoded)
+	Wipe(encoded)
+	//the secret fills the tombstone after its first byte
+	return h[:Group.G1Len()-1]
+}
+
+//ShredCommitment compute the value stored in the block to allow shredding
+//proof secret that proves ownership of the block
+//return the digest of the secret
+func ShredCommitment(proof []byte) []byte {
+	h := Hash(proof)
+	return h[:]
+}
+
+//checkTombstone check that a tombstone is justified by its block
+//record tombstone read from the key-file
+//block block of the tombstoned key
+//return true if the tombstone is consistent with the block
+func checkTombstone(record []byte, block *Block) bool {
+	switch record[0] {
+	case TombstoneShred:
+		commitment, ok := block.Fields[FieldShred]
+		return ok && bytes.Equal(commitment, ShredCommitment(record[1:]))
+	case TombstoneExpired:
+		//checked against the epoch by checkExpiry
+		return true
+	}
+	return false
+}
+
+//Shred make a block permanently undecryptable
+//the encapsulated key of the block, and of every share of the block,
+//is replaced by a tombstone that the filekeeper does not update anymore
+//index index of the block to shred
+//proof secret that proves ownership of the block, see User.ShredProof
+//return true if the block was shredded
+func (fk *FileKeeper) Shred(index int64, proof []byte) bool {
+	ledger := fk.Ledger
+	unlock := ledger.Lock()
+	if unlock == nil {
+		return false
+	}
+	defer unlock()
+	block := ledger.GetBlock(index)
+	if block == nil {
+		return false
+	}
+	if origin, _ := block.ShareOf(); origin >= 0 {
+		fmt.Println("Error shredding: block", index, "is a share, shred the shared block", origin)
+		return false
+	}
+	commitment, ok := block.Fields[FieldShred]
+	if !ok || len(proof) != Group.G1Len()-1 || !bytes.Equal(commitment, ShredCommitment(proof)) {
+		fmt.Println("Error shredding: invalid proof of ownership for block", index)
+		return false
+	}
+	//collect the block and its shares
+	targets := []int64{index}
+	tot := ledger.NumKeys()
+	for i := index + 1; i < tot; i++ {
+		share := ledger.GetBlock(i)
+		if share == nil {
+			return false
+		}
+		if origin, _ := share.ShareOf(); origin == index {
+			targets = append(targets, i)
+		}
+	}
+	//replace encapsulated keys with tombstones
+	tombstone := append([]byte{TombstoneShred}, proof...)
+	for _, i := range targets {
+		if !WriteValue(ledger.KeysFile, i, tombstone) {
+			return false
+		}
+	}
+	if !fk.audit(AuditShred, encodeEpoch(index), encodeEpoch(ledger.Epoch())) {
+		return false
+	}
+	//sign the new state of the keys file
+	return fk.signer == nil || fk.Checkpoint()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestShred(t *testing.T) {
+	ledger, fk := newTestLedger(t, 16)
+	alice, bob := GenUser(), GenUser()
+	index := alice.AddBlock(ledger, fk.TokenGen(alice.PublicKey), newTestFile(t, 500))
+	share := alice.ShareBlock(ledger, index, bob.PublicKey)
+	if index < 0 || share < 0 {
+		t.Fatal("block not shared")
+	}
+	unlocked := alice.UnlockKey(ledger.GetEncKey(index))
+	shared := bob.UnlockShared(ledger.GetSharedKey(share))
+	if ledger.DecryptRange(index, unlocked, 0, 10) == nil || ledger.DecryptRange(share, shared, 0, 10) == nil {
+		t.Fatal("block not decrypted")
+	}
+	//invalid proofs: of another user, of another block, truncated, and for a share
+	proof := alice.ShredProof(index)
+	for _, invalid := range [][]byte{bob.ShredProof(index), alice.ShredProof(share), proof[1:]} {
+		if fk.Shred(index, invalid) {
+			t.Fatal("block shredded with an invalid proof")
+		}
+	}
+	if fk.Shred(share, alice.ShredProof(share)) || ledger.GetEncKey(index) == nil {
+		t.Fatal("share shredded on its own")
+	}
+	if !fk.Shred(index, proof) {
+		t.Fatal("block not shredded")
+	}
+	//the keys of the block and of its shares are removed
+	ephemeral, masked := ledger.GetSharedKey(share)
+	if ledger.GetEncKey(index) != nil || ephemeral != nil || masked != nil {
+		t.Fatal("encapsulated keys not removed")
+	}
+	if !ledger.CheckConsistency(-1, nil) {
+		t.Fatal("tombstones not consistent")
+	}
+	//keys unlocked before the shredding do not decrypt after the update
+	if fk.Update() == nil || !ledger.CheckConsistency(-1, nil) {
+		t.Fatal("ledger not updated")
+	}
+	if ledger.DecryptRange(index, unlocked, 0, 10) != nil || ledger.DecryptRange(share, shared, 0, 10) != nil {
+		t.Fatal("shredded block decrypted")
+	}
+}
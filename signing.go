@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	curve "github.com/gaetanorusso/public_ledger_sensitive_data/miracl/go/core/BN254"
+)
+
+//SigLen byte size of a BLS signature, compressed G1 point
+const SigLen = int(curve.MODBYTES) + 1
+
+//SigPubLen byte size of a BLS public key, compressed G2 point
+const SigPubLen = 2*int(curve.MODBYTES) + 1
+
+//blsOnce precomputation needed by the BLS functions, done once
+var blsOnce sync.Once
+
+//blsInit initialise the BLS functions of the curve
+func blsInit() {
+	blsOnce.Do(func() {
+		if curve.Init() != curve.BLS_OK {
+			panic("Error initialising BLS signatures")
+		}
+	})
+}
+
+//SigningKey struct that contains a BLS key pair
+type SigningKey struct {
+	Public []byte
+	secret []byte
+}
+
+//GenSigningKey generate a new random BLS key pair
+//return the key pair
+func GenSigningKey() *SigningKey {
+	ikm := make([]byte, 2*curve.MODBYTES)
+	if _, err := rand.Read(ikm); err != nil {
+		fmt.Println("Error generating signing key:", err)
+		panic(err)
+	}
+	return SigningKeyFromSeed(ikm)
+}
+
+//SigningKeyFromSeed derive a BLS key pair from a secret seed
+//ikm input key material, at least 32 bytes
+//return the key pair
+func SigningKeyFromSeed(ikm []byte) *SigningKey {
+	blsInit()
+	key := &SigningKey{make([]byte, SigPubLen), make([]byte, curve.MODBYTES)}
+	if curve.KeyPairGenerate(ikm, key.secret, key.Public) != curve.BLS_OK {
+		panic("Error generating signing key")
+	}
+	return key
+}
+
+//Sign sign a message
+//message message to sign
+//return the signature
+func (key SigningKey) Sign(message []byte) []byte {
+	blsInit()
+	sig := make([]byte, SigLen)
+	curve.Core_Sign(sig, message, key.secret)
+	return sig
+}
+
+//VerifySignature verify a BLS signature
+//public public key of the signer
+//message signed message
+//sig signature
+//return true if the signature is valid
+func VerifySignature(public, message, sig []byte) bool {
+	if len(public) != SigPubLen || len(sig) != SigLen {
+		return false
+	}
+	blsInit()
+	return curve.Core_Verify(sig, message, public) == curve.BLS_OK
+}
+
+//Fingerprint compute a short identifier of a public key
+//encoded encoding of the public key
+//return the first 16 bytes of the digest of the key
+func Fingerprint(encoded []byte) []byte {
+	h := Hash(encoded)
+	return h[:16]
+}
+
+//decodeSigPub decode a hex encoded BLS public key
+//encoded hex encoding of the public key
+//return the public key, nil if malformed
+func decodeSigPub(encoded string) []byte {
+	public, err := hex.DecodeString(encoded)
+	if err != nil || len(public) != SigPubLen {
+		fmt.Println("Invalid signature public key:", encoded)
+		return nil
+	}
+	return public
+}
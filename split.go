@@ -2,8 +2,10 @@ package main
 
 import (
 	"bufio"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"sync"
 )
@@ -50,40 +52,25 @@ func readChunks(filename string, output chan shard, size int) {
 }
 
 //WriteResults collect results of concurrent processing and write on file
+//the output is replaced atomically: files processed in place, like the
+//key-file during an update, are never left truncated by a crash
 //results channel that feeds the results to collect
 //filename path of output file
 //done channel to signal completion: true for success, false for failure
 func writeResults(results chan shard, filename string, done chan bool) {
 	//collect results with a map
 	result := make(map[int]string)
+	size := 0
 	for ct := range results {
 		result[ct.index] = ct.value
+		size += len(ct.value)
 	}
-	//open output file
-	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		fmt.Println(err)
-		done <- false
-		return
-	}
-	//close file on exit
-	defer func() {
-		if err = file.Close(); err != nil {
-			fmt.Println("Error closing file:", err)
-			done <- false
-		}
-	}()
-	//write results on file in the correct order
+	//write results in the correct order
+	content := make([]byte, 0, size)
 	for i := 0; i < len(result); i++ {
-		_, err = file.WriteString(result[i])
-		if err != nil {
-			fmt.Println(err)
-			done <- false
-			break
-		}
+		content = append(content, result[i]...)
 	}
-	//signal succesful completion of writing
-	done <- true
+	done <- replaceFile(filename, content, 0644)
 }
 
 //ProcessFile read file and process it concurrently
@@ -151,3 +138,97 @@ func ReadValue(filePath string, index, size int64) []byte {
 	}
 	return buffer
 }
+
+//WriteValue overwrite a single value on file
+//filePath path to the file containing a series of same-size values
+//index index of the value to overwrite
+//value encoding of the new value, of the same size of the others
+//return true if the value was written successfully
+func WriteValue(filePath string, index int64, value []byte) bool {
+	//open output file
+	file, err := os.OpenFile(filePath, os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return false
+	}
+	//close file on exit
+	defer func() {
+		if err = file.Close(); err != nil {
+			fmt.Println("Error closing file:", err)
+		}
+	}()
+	//offset writing
+	_, err = file.WriteAt(value, index*int64(len(value)))
+	if err != nil {
+		fmt.Println("Error writing file:", err)
+		return false
+	}
+	return true
+}
+
+//AppendRecord append a variable-size record to a file
+//each record is preceded by its length as a 4 byte big endian integer
+//filePath path to the file containing the records
+//record content of the record
+//return true if the record was written successfully
+func AppendRecord(filePath string, record []byte) bool {
+	//open output file
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	//close file on exit
+	defer func() {
+		if err = file.Close(); err != nil {
+			fmt.Println("Error closing file:", err)
+		}
+	}()
+	//write length and content together
+	encoded := make([]byte, 4+len(record))
+	binary.BigEndian.PutUint32(encoded, uint32(len(record)))
+	copy(encoded[4:], record)
+	_, err = file.Write(encoded)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
+}
+
+//ReadRecords read all the records of a file written with AppendRecord
+//filePath path to the file containing the records
+//return the records in order, empty if the file does not exist,
+//nil if the file is truncated
+func ReadRecords(filePath string) [][]byte {
+	content, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return [][]byte{}
+	}
+	if err != nil {
+		fmt.Println("File reading error", err)
+		return nil
+	}
+	return decodeRecords(content)
+}
+
+//decodeRecords split the content of a file written with AppendRecord
+//content content of the file
+//return the records in order, nil if the content is truncated
+func decodeRecords(content []byte) [][]byte {
+	records := [][]byte{}
+	for len(content) > 0 {
+		if len(content) < 4 {
+			fmt.Println("Error reading file: incomplete record!")
+			return nil
+		}
+		size := binary.BigEndian.Uint32(content)
+		if uint64(len(content)-4) < uint64(size) {
+			fmt.Println("Error reading file: incomplete record!")
+			return nil
+		}
+		records = append(records, content[4:4+size])
+		content = content[4+size:]
+	}
+	return records
+}
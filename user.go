@@ -2,42 +2,75 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"strconv"
 
-	curve "github.com/gaetanorusso/public_ledger_sensitive_data/miracl/go/core/BN254"
+	"golang.org/x/crypto/sha3"
 )
 
 //User struct that contains public and private keys of a user
+//and the indices of the blocks added by the user
+//Rand is the source of randomness of the user, crypto/rand if nil
 type User struct {
-	PublicKey *curve.ECP
-	mu        *curve.BIG
-	v         *curve.BIG
+	PublicKey G1
+	mu        Scalar
+	v         Scalar
+	Blocks    []int64
+	Rand      io.Reader
 }
 
 //GenUser generate new random keys
 func GenUser() *User {
+	return GenUserFrom(nil)
+}
+
+//GenUserFrom generate new random keys reading from a source of randomness
+//rng source of randomness, kept by the user; nil to use crypto/rand
+func GenUserFrom(rng io.Reader) *User {
 	//generate random private keys
-	mu := GenExp()
-	v := GenExp()
+	mu := GenExpFrom(rng)
+	v := GenExpFrom(rng)
 	//compute public key
-	pk := curve.G1mul(B1, mu)
-	return &User{pk, mu, v}
+	pk := Group.G1Generator().Mul(mu)
+	return &User{PublicKey: pk, mu: mu, v: v, Rand: rng}
+}
+
+//SigningKey derive the BLS key pair the user signs blocks with
+//the seed is hashed with SHA3-512 whatever the hash function of the ledger,
+//so that the key registered by the user, or pinned for the filekeeper,
+//does not change with the settings
+//private keys are taken from User struct u
+//return the signing key
+func (u User) SigningKey() *SigningKey {
+	seed := append([]byte("sign"), u.mu.Bytes()...)
+	seed = append(seed, u.v.Bytes()...)
+	h := sha3.Sum512(seed)
+	Wipe(seed)
+	defer Wipe(h[:])
+	return SigningKeyFromSeed(h[:])
 }
 
 //EncapsulateKey encapsulated an encryption key
 //key encryption key to be encapsulated
 //private keys are taken from User struct u
-//return encapsulated key
-func (u User) EncapsulateKey(key *curve.ECP) *curve.ECP {
+//return encapsulated key, nil if the private keys have been destroyed
+func (u User) EncapsulateKey(key G1) G1 {
+	if u.mu == nil || u.v == nil {
+		fmt.Println("Error encapsulating key: private keys not available")
+		return nil
+	}
 	return FracMult(key, u.mu, u.v)
 }
 
 //UnlockKey unlock an encapsulated key for decryption
 //keyEnc encapsulated key to be unlocked
 //private keys are taken from User struct u
-//return unlocked key
-func (u User) UnlockKey(keyEnc *curve.ECP) *curve.ECP {
+//return unlocked key, nil if the private keys have been destroyed
+func (u User) UnlockKey(keyEnc G1) G1 {
+	if u.mu == nil || u.v == nil {
+		fmt.Println("Error unlocking key: private keys not available")
+		return nil
+	}
 	return FracMult(keyEnc, u.v, u.mu)
 }
 
@@ -60,16 +93,16 @@ func CountShards(filePath string) int {
 //outputFile path to output file
 //eps masking shards for encryption
 //key encryption key
-func EncryptFile(inputFile, outputFile string, eps []curve.ECP2, key *curve.ECP) {
+func EncryptFile(inputFile, outputFile string, eps []G2, key G1) {
 	//check that there are enough masking shards to encrypt
 	numShards := CountShards(inputFile)
-	if numShards > MaxShards {
+	if numShards > len(eps) {
 		fmt.Println("File too big!")
 		return
 	}
 	encr := func(inp shard) shard {
 		//encrypt using appropriate masking shard
-		ct := OneTimePad([]byte(inp.value), &eps[inp.index], key)
+		ct := OneTimePad([]byte(inp.value), eps[inp.index], key)
 		//feed result to output channel
 		return shard{inp.index, string(ct)}
 	}
@@ -80,52 +113,49 @@ func EncryptFile(inputFile, outputFile string, eps []curve.ECP2, key *curve.ECP)
 //ledger struct with file paths of the ledger
 //token encryption token given by filekeeper
 //fileName path to file to encrypt
+//the index is also recorded in the list of blocks owned by the user
 //return the index of the added block (and corresponding encapsulated key)
-func (u User) AddBlock(ledger Ledger, token *curve.ECP, fileName string) int64 {
-	//compute no. of shards necessary, for checking and optimal reading
-	numShards := CountShards(fileName)
-	//generate encryption key
-	key := curve.G1mul(token, GenExp())
-	//compute the encapsulated key
-	keyEnc := u.EncapsulateKey(key)
-	//save encapsulated key on the ledger
-	keyIndex := ledger.AppendEncapsulatedKey(keyEnc)
-	//read masking shards from file
-	eps := ledger.GetShards(numShards)
-	//compute ciphertext file name
-	ctName := ledger.EncryptPath + strconv.FormatInt(keyIndex, 16) + ".enc"
-	//encrypt file
-	EncryptFile(fileName, ctName, eps[:], key)
-	//compute content concatenating digests
-	//first hash of previous block
-	content := FileDigest(ledger.RootPath + strconv.FormatInt(keyIndex, 16))
-	//then ciphertext and plaintext
-	content = append(content, FileDigest(ctName)...)
-	content = append(content, FileDigest(fileName)...)
-	//finally control shard
-	i := keyIndex % int64(MaxShards)
-	if i < int64(numShards) {
-		content = append(content, HashAte(&eps[i], keyEnc)...)
-	} else {
-		content = append(content, HashAte(ledger.GetSingleShard(i), keyEnc)...)
+func (u *User) AddBlock(ledger Ledger, token G1, fileName string) int64 {
+	return u.AddBlockWith(ledger, token, fileName, BlockOptions{})
+}
+
+//AddBlockWith encrypt a file and add it to the ledger with optional fields
+//ledger struct with file paths of the ledger
+//token encryption token given by filekeeper
+//fileName path to file to encrypt
+//opts optional settings of the block
+//the index is also recorded in the list of blocks owned by the user
+//return the index of the added block (and corresponding encapsulated key),
+//-1 if the block would already be expired or cannot be added
+func (u *User) AddBlockWith(ledger Ledger, token G1, fileName string, opts BlockOptions) int64 {
+	indices := u.AddBlocks(ledger, token, []string{fileName}, opts)
+	if indices == nil {
+		return -1
 	}
-	//write block on file
-	blockName := ledger.RootPath + strconv.FormatInt(keyIndex+1, 16)
-	//open file
-	file, err := os.OpenFile(blockName, os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		panic(err)
+	return indices[0]
+}
+
+//setFields set the fields of a new block owned by the user
+//block block to complete, digests and control shard already set
+//keyIndex index of the block
+//opts optional settings of the block
+//signer signing key of the user, derived from the private keys if nil
+func (u User) setFields(block *Block, keyIndex int64, opts BlockOptions, signer *SigningKey) {
+	//commitment to the secret that allows the owner to shred the block
+	block.Fields[FieldShred] = ShredCommitment(u.ShredProof(keyIndex))
+	//optional fields
+	if opts.Author != nil {
+		block.Fields[FieldAuthor] = opts.Author
+	}
+	if opts.Expiry > 0 {
+		block.Fields[FieldExpiry] = encodeEpoch(opts.Expiry)
 	}
-	//close file on exit
-	defer func() {
-		if err = file.Close(); err != nil {
-			fmt.Println("Error closing file:", err)
+	//signature on every other field
+	if opts.Sign {
+		if signer == nil {
+			signer = u.SigningKey()
 		}
-	}()
-	//write content
-	_, err = file.Write(content)
-	if err != nil {
-		panic(err)
+		block.Fields[FieldSigner] = signer.Public
+		block.Fields[FieldSignature] = signer.Sign(block.SignedContent())
 	}
-	return keyIndex
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//vectorsFile path of the known-answer vectors of the protocol
+const vectorsFile = "test/vectors.json"
+
+//updateVectors regenerate the outputs of the vectors instead of checking them
+var updateVectors = flag.Bool("vectors", false, "regenerate the outputs in "+vectorsFile)
+
+//knownAnswers known-answer vector of the protocol on BN254
+//the inputs are the seeds of the DRBGs of ledger, user and encryption key,
+//the number of shards and the plaintext; the outputs are hex encoded,
+//files are encoded whole
+type knownAnswers struct {
+	LedgerSeed string `json:"ledger_seed"`
+	UserSeed   string `json:"user_seed"`
+	KeySeed    string `json:"key_seed"`
+	Shards     int    `json:"shards"`
+	Plaintext  string `json:"plaintext"`
+	//Init
+	TimeKey    string `json:"time_key"`
+	ShardsFile string `json:"shards_file"`
+	//TokenGen, EncapsulateKey, UnlockKey
+	PublicKey       string `json:"public_key"`
+	Token           string `json:"token"`
+	Key             string `json:"key"`
+	EncapsulatedKey string `json:"encapsulated_key"`
+	UnlockedKey     string `json:"unlocked_key"`
+	//HashAte and OneTimePad with the first shard
+	Pad        string `json:"pad"`
+	Ciphertext string `json:"ciphertext"`
+	//AddBlock
+	KeysFile       string `json:"keys_file"`
+	CiphertextFile string `json:"ciphertext_file"`
+	Block          string `json:"block"`
+	//Update
+	UpdatedTimeKey    string `json:"updated_time_key"`
+	UpdatedShardsFile string `json:"updated_shards_file"`
+	UpdatedKeysFile   string `json:"updated_keys_file"`
+}
+
+//vectorTime modification time of the plaintext file, part of its metadata
+var vectorTime = time.Unix(1600000000, 0)
+
+//hexFile read a file and hex encode its content
+func hexFile(t *testing.T, name string) string {
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(content)
+}
+
+//computeAnswers run the protocol on the inputs of a vector
+//in vector with the inputs
+//return the vector with the outputs computed
+func computeAnswers(t *testing.T, in knownAnswers) knownAnswers {
+	if !SetAlgorithms("sha3-512", "shake256") {
+		t.Fatal("default algorithms not available")
+	}
+	out := knownAnswers{LedgerSeed: in.LedgerSeed, UserSeed: in.UserSeed, KeySeed: in.KeySeed, Shards: in.Shards, Plaintext: in.Plaintext}
+	ledger, fk := newTestLedgerFrom(t, BN254{}, in.Shards, NewDRBG([]byte(in.LedgerSeed)))
+	out.TimeKey = hex.EncodeToString(fk.s.Bytes())
+	out.ShardsFile = hexFile(t, ledger.ShardsFile)
+	u := GenUserFrom(NewDRBG([]byte(in.UserSeed)))
+	out.PublicKey = hex.EncodeToString(u.PublicKey.Bytes())
+	token := fk.TokenGen(u.PublicKey)
+	out.Token = hex.EncodeToString(token.Bytes())
+	key := token.Mul(GenExpFrom(NewDRBG([]byte(in.KeySeed))))
+	out.Key = hex.EncodeToString(key.Bytes())
+	keyEnc := u.EncapsulateKey(key)
+	out.EncapsulatedKey = hex.EncodeToString(keyEnc.Bytes())
+	out.UnlockedKey = hex.EncodeToString(u.UnlockKey(keyEnc).Bytes())
+	shard := ledger.GetSingleShard(0)
+	out.Pad = hex.EncodeToString(HashAte(shard, key))
+	out.Ciphertext = hex.EncodeToString(OneTimePad([]byte(in.Plaintext), shard, key))
+	//the name and the modification time of the file are part of the block
+	file := filepath.Join(t.TempDir(), "vector")
+	if err := ioutil.WriteFile(file, []byte(in.Plaintext), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, vectorTime, vectorTime); err != nil {
+		t.Fatal(err)
+	}
+	index := u.AddBlock(ledger, token, file)
+	if index != 0 {
+		t.Fatal("block not added")
+	}
+	out.KeysFile = hexFile(t, ledger.KeysFile)
+	out.CiphertextFile = hexFile(t, ledger.EncryptPath+"0.enc")
+	out.Block = hexFile(t, ledger.BlockName(index))
+	sNew := fk.Update()
+	if sNew == nil {
+		t.Fatal("update failed")
+	}
+	out.UpdatedTimeKey = hex.EncodeToString(sNew.Bytes())
+	out.UpdatedShardsFile = hexFile(t, ledger.ShardsFile)
+	out.UpdatedKeysFile = hexFile(t, ledger.KeysFile)
+	return out
+}
+
+func TestKnownAnswers(t *testing.T) {
+	content, err := ioutil.ReadFile(vectorsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []knownAnswers
+	if err = json.Unmarshal(content, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range vectors {
+		got := computeAnswers(t, want)
+		if *updateVectors {
+			vectors[i] = got
+			continue
+		}
+		//report every output that differs
+		wantValue, gotValue := reflect.ValueOf(want), reflect.ValueOf(got)
+		for f := 0; f < wantValue.NumField(); f++ {
+			if wantValue.Field(f).Interface() != gotValue.Field(f).Interface() {
+				t.Errorf("vector %d: %s differs", i, wantValue.Type().Field(f).Name)
+			}
+		}
+		//the unlocked key is the encryption key
+		if got.UnlockedKey != got.Key {
+			t.Errorf("vector %d: UnlockKey does not invert EncapsulateKey", i)
+		}
+	}
+	if *updateVectors {
+		var encoded bytes.Buffer
+		encoder := json.NewEncoder(&encoded)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(vectors); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(vectorsFile, encoded.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}